@@ -9,6 +9,8 @@ import (
 type Node interface {
 	Literal() string
 	String() string
+	Pos() token.Position // 节点第一个字符的位置
+	End() token.Position // 节点最后一个字符之后的位置
 }
 
 type Statement interface {
@@ -37,6 +39,19 @@ func (p *Program) Literal() string {
 	// }
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+func (p *Program) End() token.Position {
+	if n := len(p.Statements); n > 0 {
+		return p.Statements[n-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -49,6 +64,7 @@ func (p *Program) String() string {
 type VarStatement struct {
 	Token token.Token
 	Name  *Identifier
+	Names []*Identifier // var q, r = f() 声明多个名字时使用，此时 Name 为 nil
 	Value Expression
 }
 
@@ -56,11 +72,32 @@ func (vs *VarStatement) statementNode() {}
 func (vs *VarStatement) Literal() string {
 	return vs.Token.Literal
 }
+func (vs *VarStatement) Pos() token.Position { return vs.Token.Pos }
+func (vs *VarStatement) End() token.Position {
+	if vs.Value != nil {
+		return vs.Value.End()
+	}
+	idents := vs.Idents()
+	return idents[len(idents)-1].End()
+}
+
+// Idents returns the declared names, Name or Names.
+func (vs *VarStatement) Idents() []*Identifier {
+	if vs.Names != nil {
+		return vs.Names
+	}
+	return []*Identifier{vs.Name}
+}
 func (vs *VarStatement) String() string {
 	var out bytes.Buffer
 
+	names := []string{}
+	for _, name := range vs.Idents() {
+		names = append(names, name.String())
+	}
+
 	out.WriteString(vs.Literal() + " ")
-	out.WriteString(vs.Name.String())
+	out.WriteString(strings.Join(names, ", "))
 	out.WriteString(" = ")
 
 	if vs.Value != nil {
@@ -72,21 +109,81 @@ func (vs *VarStatement) String() string {
 	return out.String()
 }
 
+// ConstStatement is const NAME = value, or a group of them in parentheses:
+// const ( A = 1; B = 2 ). The Token of each spec is the const.
+type ConstStatement struct {
+	Token  token.Token // 'const'词法单元
+	Specs  []*VarStatement
+	Rparen token.Token // ')'词法单元, 不分组时为空
+}
+
+func (cs *ConstStatement) statementNode()      {}
+func (cs *ConstStatement) Literal() string     { return cs.Token.Literal }
+func (cs *ConstStatement) Pos() token.Position { return cs.Token.Pos }
+func (cs *ConstStatement) Grouped() bool       { return cs.Rparen.Type == token.RPAREN }
+func (cs *ConstStatement) End() token.Position {
+	if cs.Grouped() {
+		return cs.Rparen.End
+	}
+	return cs.Specs[0].End()
+}
+func (cs *ConstStatement) String() string {
+	if !cs.Grouped() {
+		return cs.Specs[0].String()
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString("const (\n")
+	for _, spec := range cs.Specs {
+		out.WriteString("\t" + spec.Name.String() + " = " + spec.Value.String() + "\n")
+	}
+	out.WriteString(");\n")
+
+	return out.String()
+}
+
 type AssignStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token    token.Token
+	Name     *Identifier
+	Target   Expression   // a[i] = v 这类左值不是标识符时使用，此时 Name 为 nil
+	Targets  []Expression // a, b = b, a 有多个左值时使用，此时 Name 和 Target 为 nil
+	Operator string       // "=", "+=", "-=", "*=", "/=" or "%="
+	Value    Expression
 }
 
 func (as *AssignStatement) statementNode() {}
 func (as *AssignStatement) Literal() string {
 	return as.Token.Literal
 }
+func (as *AssignStatement) Pos() token.Position { return as.Left().Pos() }
+func (as *AssignStatement) End() token.Position {
+	if as.Value != nil {
+		return as.Value.End()
+	}
+	return as.Left().End()
+}
+
+// Left returns the assigned expression, Name or Target, or a tuple of the
+// Targets.
+func (as *AssignStatement) Left() Expression {
+	if as.Targets != nil {
+		return &TupleLiteral{Elements: as.Targets}
+	}
+	if as.Target != nil {
+		return as.Target
+	}
+	return as.Name
+}
 func (as *AssignStatement) String() string {
 	var out bytes.Buffer
 
-	out.WriteString(as.Name.String())
-	out.WriteString(" = ")
+	out.WriteString(as.Left().String())
+	if as.Operator != "" {
+		out.WriteString(" " + as.Operator + " ")
+	} else {
+		out.WriteString(" = ")
+	}
 
 	if as.Value != nil {
 		out.WriteString(as.Value.String())
@@ -97,13 +194,55 @@ func (as *AssignStatement) String() string {
 	return out.String()
 }
 
+// IncDecStatement is x++ or x--, Target is an identifier or an index
+// expression.
+type IncDecStatement struct {
+	Token  token.Token // '++'或'--'词法单元
+	Target Expression
+}
+
+func (ids *IncDecStatement) statementNode()      {}
+func (ids *IncDecStatement) Literal() string     { return ids.Token.Literal }
+func (ids *IncDecStatement) Pos() token.Position { return ids.Target.Pos() }
+func (ids *IncDecStatement) End() token.Position { return ids.Token.End }
+func (ids *IncDecStatement) String() string {
+	return ids.Target.String() + ids.Token.Literal + ";"
+}
+
+// TypeStatement declares a named type: type Point struct { x int; y int }
+type TypeStatement struct {
+	Token token.Token // 'type'词法单元
+	Name  *Identifier
+	Type  Expression // *StructType or *InterfaceType
+}
+
+func (ts *TypeStatement) statementNode()      {}
+func (ts *TypeStatement) Literal() string     { return ts.Token.Literal }
+func (ts *TypeStatement) Pos() token.Position { return ts.Token.Pos }
+func (ts *TypeStatement) End() token.Position {
+	if ts.Type != nil {
+		return ts.Type.End()
+	}
+	return ts.Name.End()
+}
+func (ts *TypeStatement) String() string {
+	return "type " + ts.Name.String() + " " + ts.Type.String() + ";"
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
 }
 
-func (rs *ReturnStatement) statementNode()  {}
-func (rs *ReturnStatement) Literal() string { return rs.Token.Literal }
+func (rs *ReturnStatement) statementNode()      {}
+func (rs *ReturnStatement) Literal() string     { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -119,15 +258,24 @@ func (rs *ReturnStatement) String() string {
 }
 
 type Identifier struct {
-	Token token.Token
-	Value string
-	Type  *Identifier
+	Token   token.Token
+	Value   string
+	Type    *Identifier
+	Binding *Binding // 由 resolver 填写, nil 时按名字查找
+}
+
+// Binding locates the declaration a name refers to: it is in the scope
+// Depth scopes out from where it is used. Depth is -1 for the global scope.
+type Binding struct {
+	Depth int
 }
 
 func (i *Identifier) expressionNode() {}
 func (i *Identifier) Literal() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -137,8 +285,15 @@ type ExpressionStatement struct {
 	Expression Expression
 }
 
-func (es *ExpressionStatement) statementNode()  {}
-func (es *ExpressionStatement) Literal() string { return es.Token.Literal }
+func (es *ExpressionStatement) statementNode()      {}
+func (es *ExpressionStatement) Literal() string     { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -151,27 +306,44 @@ type IntegerLiteral struct {
 	Value int64
 }
 
-func (il *IntegerLiteral) expressionNode() {}
-func (il *IntegerLiteral) Literal() string { return il.Token.Literal }
-func (il *IntegerLiteral) String() string  { return il.Token.Literal }
+func (il *IntegerLiteral) expressionNode()     {}
+func (il *IntegerLiteral) Literal() string     { return il.Token.Literal }
+func (il *IntegerLiteral) String() string      { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()     {}
+func (fl *FloatLiteral) Literal() string     { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string      { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position { return fl.Token.End }
 
 type BooleanLiteral struct {
 	Token token.Token
 	Value bool
 }
 
-func (bl *BooleanLiteral) expressionNode() {}
-func (bl *BooleanLiteral) Literal() string { return bl.Token.Literal }
-func (bl *BooleanLiteral) String() string  { return bl.Token.Literal }
+func (bl *BooleanLiteral) expressionNode()     {}
+func (bl *BooleanLiteral) Literal() string     { return bl.Token.Literal }
+func (bl *BooleanLiteral) String() string      { return bl.Token.Literal }
+func (bl *BooleanLiteral) Pos() token.Position { return bl.Token.Pos }
+func (bl *BooleanLiteral) End() token.Position { return bl.Token.End }
 
 type NilLiteral struct {
 	Token token.Token
 	Value string
 }
 
-func (bl *NilLiteral) expressionNode() {}
-func (bl *NilLiteral) Literal() string { return bl.Token.Literal }
-func (bl *NilLiteral) String() string  { return bl.Token.Literal }
+func (bl *NilLiteral) expressionNode()     {}
+func (bl *NilLiteral) Literal() string     { return bl.Token.Literal }
+func (bl *NilLiteral) String() string      { return bl.Token.Literal }
+func (bl *NilLiteral) Pos() token.Position { return bl.Token.Pos }
+func (bl *NilLiteral) End() token.Position { return bl.Token.End }
 
 type PrefixExpression struct {
 	Token    token.Token // 前缀词法单元，如!
@@ -179,8 +351,15 @@ type PrefixExpression struct {
 	Right    Expression
 }
 
-func (pe *PrefixExpression) expressionNode() {}
-func (pe *PrefixExpression) Literal() string { return pe.Token.Literal }
+func (pe *PrefixExpression) expressionNode()     {}
+func (pe *PrefixExpression) Literal() string     { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -199,8 +378,15 @@ type InfixExpression struct {
 	Right    Expression
 }
 
-func (ie *InfixExpression) expressionNode() {}
-func (ie *InfixExpression) Literal() string { return ie.Token.Literal }
+func (ie *InfixExpression) expressionNode()     {}
+func (ie *InfixExpression) Literal() string     { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right != nil {
+		return ie.Right.End()
+	}
+	return ie.Token.End
+}
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -217,16 +403,44 @@ func (ie *InfixExpression) String() string {
 
 type ForStatement struct {
 	Token     token.Token
+	Label     *Identifier // outer: for ...
 	Condition []Statement
 	Body      *BlockStatement
+
+	// for k, v in Range {}, Key is nil for for v in Range {}
+	Key   *Identifier
+	Value *Identifier
+	Range Expression
 }
 
 func (fs *ForStatement) statementNode()  {}
 func (fs *ForStatement) Literal() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position {
+	if fs.Label != nil {
+		return fs.Label.Pos()
+	}
+	return fs.Token.Pos
+}
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return fs.Token.End
+}
 func (fs *ForStatement) String() string {
 	var out bytes.Buffer
 
+	if fs.Label != nil {
+		out.WriteString(fs.Label.String() + ": ")
+	}
 	out.WriteString("for")
+	if fs.Range != nil {
+		out.WriteString(" ")
+		if fs.Key != nil {
+			out.WriteString(fs.Key.String() + ", ")
+		}
+		out.WriteString(fs.Value.String() + " in " + fs.Range.String())
+	}
 	for _, s := range fs.Condition {
 		out.WriteString(s.String())
 	}
@@ -236,6 +450,114 @@ func (fs *ForStatement) String() string {
 	return out.String()
 }
 
+type BreakStatement struct {
+	Token token.Token // 'break'词法单元
+	Label *Identifier
+}
+
+func (bs *BreakStatement) statementNode()      {}
+func (bs *BreakStatement) Literal() string     { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position {
+	if bs.Label != nil {
+		return bs.Label.End()
+	}
+	return bs.Token.End
+}
+func (bs *BreakStatement) String() string {
+	if bs.Label != nil {
+		return "break " + bs.Label.String() + ";"
+	}
+	return "break;"
+}
+
+type ContinueStatement struct {
+	Token token.Token // 'continue'词法单元
+	Label *Identifier
+}
+
+func (cs *ContinueStatement) statementNode()      {}
+func (cs *ContinueStatement) Literal() string     { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position {
+	if cs.Label != nil {
+		return cs.Label.End()
+	}
+	return cs.Token.End
+}
+func (cs *ContinueStatement) String() string {
+	if cs.Label != nil {
+		return "continue " + cs.Label.String() + ";"
+	}
+	return "continue;"
+}
+
+// SwitchStatement is switch tag { case a, b: ... default: ... }. Without
+// a tag, the first case whose value is true runs.
+type SwitchStatement struct {
+	Token  token.Token // 'switch'词法单元
+	Tag    Expression  // nil for switch {}
+	Cases  []*CaseClause
+	Rbrace token.Token
+}
+
+func (ss *SwitchStatement) statementNode()      {}
+func (ss *SwitchStatement) Literal() string     { return ss.Token.Literal }
+func (ss *SwitchStatement) Pos() token.Position { return ss.Token.Pos }
+func (ss *SwitchStatement) End() token.Position { return ss.Rbrace.End }
+func (ss *SwitchStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("switch ")
+	if ss.Tag != nil {
+		out.WriteString(ss.Tag.String() + " ")
+	}
+	out.WriteString("{ ")
+	for _, c := range ss.Cases {
+		out.WriteString(c.String() + " ")
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// CaseClause is a case of a switch, Values is nil for the default case.
+type CaseClause struct {
+	Token  token.Token // 'case' 或 'default'词法单元
+	Values []Expression
+	Body   *BlockStatement
+}
+
+// Fallthrough reports whether the body ends with fallthrough.
+func (cc *CaseClause) Fallthrough() bool {
+	if len(cc.Body.Statements) == 0 {
+		return false
+	}
+	_, ok := cc.Body.Statements[len(cc.Body.Statements)-1].(*FallthroughStatement)
+	return ok
+}
+
+func (cc *CaseClause) String() string {
+	if cc.Values == nil {
+		return "default: " + cc.Body.String()
+	}
+	values := []string{}
+	for _, v := range cc.Values {
+		values = append(values, v.String())
+	}
+	return "case " + strings.Join(values, ", ") + ": " + cc.Body.String()
+}
+
+type FallthroughStatement struct {
+	Token token.Token // 'fallthrough'词法单元
+}
+
+func (fs *FallthroughStatement) statementNode()      {}
+func (fs *FallthroughStatement) Literal() string     { return fs.Token.Literal }
+func (fs *FallthroughStatement) Pos() token.Position { return fs.Token.Pos }
+func (fs *FallthroughStatement) End() token.Position { return fs.Token.End }
+func (fs *FallthroughStatement) String() string      { return "fallthrough;" }
+
 type IfExpression struct {
 	Token       token.Token // 'if'词法单元
 	Condition   Expression
@@ -244,8 +566,21 @@ type IfExpression struct {
 	Alternative *BlockStatement
 }
 
-func (ie *IfExpression) expressionNode() {}
-func (ie *IfExpression) Literal() string { return ie.Token.Literal }
+func (ie *IfExpression) expressionNode()     {}
+func (ie *IfExpression) Literal() string     { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if n := len(ie.Options); n > 0 {
+		return ie.Options[n-1].End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return ie.Token.End
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -265,10 +600,18 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token // '{'词法单元
 	Statements []Statement
+	Rbrace     token.Token // '}'词法单元
 }
 
-func (bs *BlockStatement) statementNode()  {}
-func (bs *BlockStatement) Literal() string { return bs.Token.Literal }
+func (bs *BlockStatement) statementNode()      {}
+func (bs *BlockStatement) Literal() string     { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.Pos.IsValid() {
+		return bs.Rbrace.End
+	}
+	return bs.Token.End
+}
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -280,15 +623,40 @@ func (bs *BlockStatement) String() string {
 }
 
 type FunctionLiteral struct {
-	Token      token.Token // 'func'词法单元
-	Name       *Identifier
-	ReturnType *Identifier
-	Args       []*Identifier
-	Body       *BlockStatement
+	Token       token.Token // 'func'词法单元
+	Receiver    *Identifier // 方法的接收者: func (p Point) norm() {}
+	Name        *Identifier
+	ReturnType  *Identifier
+	ReturnTypes []*Identifier // 返回多个值: func f() (int, int) {}，此时 ReturnType 为 nil
+	Args        []*Identifier
+	Body        *BlockStatement
 }
 
-func (fl *FunctionLiteral) expressionNode() {}
-func (fl *FunctionLiteral) Literal() string { return fl.Token.Literal }
+// Results returns the result types as written after the parameters, "" if
+// there are none.
+func (fl *FunctionLiteral) Results() string {
+	if fl.ReturnType != nil {
+		return fl.ReturnType.String()
+	}
+	if fl.ReturnTypes == nil {
+		return ""
+	}
+	types := []string{}
+	for _, t := range fl.ReturnTypes {
+		types = append(types, t.String())
+	}
+	return "(" + strings.Join(types, ", ") + ")"
+}
+
+func (fl *FunctionLiteral) expressionNode()     {}
+func (fl *FunctionLiteral) Literal() string     { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -298,6 +666,9 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	out.WriteString(fl.Literal())
+	if fl.Receiver != nil {
+		out.WriteString(" (" + fl.Receiver.String() + " " + fl.Receiver.Type.String() + ") " + fl.Name.String())
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
@@ -306,14 +677,41 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// TupleLiteral is a list of values separated by commas, given to a return,
+// a var or an assignment: return q, r
+type TupleLiteral struct {
+	Token    token.Token // 第一个','词法单元
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode()     {}
+func (tl *TupleLiteral) Literal() string     { return tl.Token.Literal }
+func (tl *TupleLiteral) Pos() token.Position { return tl.Elements[0].Pos() }
+func (tl *TupleLiteral) End() token.Position { return tl.Elements[len(tl.Elements)-1].End() }
+func (tl *TupleLiteral) String() string {
+	elements := []string{}
+	for _, el := range tl.Elements {
+		elements = append(elements, el.String())
+	}
+	return strings.Join(elements, ", ")
+}
+
 type CallExpression struct {
 	Token    token.Token // '('词法单元
 	Function Expression  // 标识符或函数字面量
 	Args     []Expression
+	Rparen   token.Token // ')'词法单元
 }
 
-func (ce *CallExpression) expressionNode() {}
-func (ce *CallExpression) Literal() string { return ce.Token.Literal }
+func (ce *CallExpression) expressionNode()     {}
+func (ce *CallExpression) Literal() string     { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position { return ce.Function.Pos() }
+func (ce *CallExpression) End() token.Position {
+	if ce.Rparen.Pos.IsValid() {
+		return ce.Rparen.End
+	}
+	return ce.Token.End
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -335,6 +733,305 @@ type StringLiteral struct {
 	Value string
 }
 
-func (sl *StringLiteral) expressionNode() {}
-func (sl *StringLiteral) Literal() string { return sl.Token.Literal }
-func (sl *StringLiteral) String() string  { return sl.Token.Literal }
+func (sl *StringLiteral) expressionNode()     {}
+func (sl *StringLiteral) Literal() string     { return sl.Token.Literal }
+func (sl *StringLiteral) String() string      { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position { return sl.Token.End }
+
+type ArrayLiteral struct {
+	Token    token.Token // '['词法单元
+	Elements []Expression
+	Rbracket token.Token // ']'词法单元
+}
+
+func (al *ArrayLiteral) expressionNode()     {}
+func (al *ArrayLiteral) Literal() string     { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position { return al.Rbracket.End }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token    token.Token // '['词法单元
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token // ']'词法单元
+}
+
+func (ie *IndexExpression) expressionNode()     {}
+func (ie *IndexExpression) Literal() string     { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *IndexExpression) End() token.Position { return ie.Rbracket.End }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// SliceExpression is a[Low:High], Low and High are nil when omitted.
+type SliceExpression struct {
+	Token    token.Token // '['词法单元
+	Left     Expression
+	Low      Expression
+	High     Expression
+	Rbracket token.Token // ']'词法单元
+}
+
+func (se *SliceExpression) expressionNode()     {}
+func (se *SliceExpression) Literal() string     { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position { return se.Left.Pos() }
+func (se *SliceExpression) End() token.Position { return se.Rbracket.End }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// HashLiteral keeps its pairs in source order, Keys[i] maps to Values[i].
+type HashLiteral struct {
+	Token  token.Token // '{'词法单元
+	Keys   []Expression
+	Values []Expression
+	Rbrace token.Token // '}'词法单元
+}
+
+func (hl *HashLiteral) expressionNode()     {}
+func (hl *HashLiteral) Literal() string     { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position { return hl.Rbrace.End }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for i, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Values[i].String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// StructType is struct { x int; y int }, each field is an identifier with
+// its type.
+type StructType struct {
+	Token  token.Token // 'struct'词法单元
+	Fields []*Identifier
+	Rbrace token.Token // '}'词法单元
+}
+
+func (st *StructType) expressionNode()     {}
+func (st *StructType) Literal() string     { return st.Token.Literal }
+func (st *StructType) Pos() token.Position { return st.Token.Pos }
+func (st *StructType) End() token.Position { return st.Rbrace.End }
+func (st *StructType) String() string {
+	fields := []string{}
+	for _, f := range st.Fields {
+		fields = append(fields, f.String()+" "+f.Type.String())
+	}
+	return "struct { " + strings.Join(fields, "; ") + " }"
+}
+
+// InterfaceType is interface { area() int }, the methods of an interface
+// are function literals without a body.
+type InterfaceType struct {
+	Token   token.Token // 'interface'词法单元
+	Methods []*FunctionLiteral
+	Rbrace  token.Token // '}'词法单元
+}
+
+func (it *InterfaceType) expressionNode()     {}
+func (it *InterfaceType) Literal() string     { return it.Token.Literal }
+func (it *InterfaceType) Pos() token.Position { return it.Token.Pos }
+func (it *InterfaceType) End() token.Position { return it.Rbrace.End }
+func (it *InterfaceType) String() string {
+	methods := []string{}
+	for _, m := range it.Methods {
+		params := []string{}
+		for _, p := range m.Args {
+			params = append(params, p.String()+" "+p.Type.String())
+		}
+		s := m.Name.String() + "(" + strings.Join(params, ", ") + ")"
+		if results := m.Results(); results != "" {
+			s += " " + results
+		}
+		methods = append(methods, s)
+	}
+	return "interface { " + strings.Join(methods, "; ") + " }"
+}
+
+// StructLiteral is Point{x: 1, y: 2}, Fields[i] is set to Values[i].
+type StructLiteral struct {
+	Token  token.Token // '{'词法单元
+	Name   *Identifier
+	Fields []*Identifier
+	Values []Expression
+	Rbrace token.Token // '}'词法单元
+}
+
+func (sl *StructLiteral) expressionNode()     {}
+func (sl *StructLiteral) Literal() string     { return sl.Token.Literal }
+func (sl *StructLiteral) Pos() token.Position { return sl.Name.Pos() }
+func (sl *StructLiteral) End() token.Position { return sl.Rbrace.End }
+func (sl *StructLiteral) String() string {
+	fields := []string{}
+	for i, f := range sl.Fields {
+		fields = append(fields, f.String()+": "+sl.Values[i].String())
+	}
+	return sl.Name.String() + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// SelectorExpression selects a field or a method: p.x, p.norm
+type SelectorExpression struct {
+	Token token.Token // '.'词法单元
+	Left  Expression
+	Field *Identifier
+}
+
+func (se *SelectorExpression) expressionNode()     {}
+func (se *SelectorExpression) Literal() string     { return se.Token.Literal }
+func (se *SelectorExpression) Pos() token.Position { return se.Left.Pos() }
+func (se *SelectorExpression) End() token.Position { return se.Field.End() }
+func (se *SelectorExpression) String() string {
+	return se.Left.String() + "." + se.Field.String()
+}
+
+// TypeAssertion is s.(Circle), the value of s if it is of type Circle.
+type TypeAssertion struct {
+	Token  token.Token // '.'词法单元
+	Left   Expression
+	Type   *Identifier
+	Rparen token.Token // ')'词法单元
+}
+
+func (ta *TypeAssertion) expressionNode()     {}
+func (ta *TypeAssertion) Literal() string     { return ta.Token.Literal }
+func (ta *TypeAssertion) Pos() token.Position { return ta.Left.Pos() }
+func (ta *TypeAssertion) End() token.Position { return ta.Rparen.End }
+func (ta *TypeAssertion) String() string {
+	return ta.Left.String() + ".(" + ta.Type.String() + ")"
+}
+
+// EnumStatement declares an enum and its variants:
+// enum Result { Ok(v), Err(msg) }
+type EnumStatement struct {
+	Token    token.Token // 'enum'词法单元
+	Name     *Identifier
+	Variants []*Variant
+	Rbrace   token.Token // '}'词法单元
+}
+
+// Variant is a variant of an enum with the names of its payload, Fields is
+// empty for a variant without payload.
+type Variant struct {
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (v *Variant) String() string {
+	if len(v.Fields) == 0 {
+		return v.Name.String()
+	}
+	fields := []string{}
+	for _, f := range v.Fields {
+		fields = append(fields, f.String())
+	}
+	return v.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
+func (es *EnumStatement) statementNode()      {}
+func (es *EnumStatement) Literal() string     { return es.Token.Literal }
+func (es *EnumStatement) Pos() token.Position { return es.Token.Pos }
+func (es *EnumStatement) End() token.Position { return es.Rbrace.End }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+	for _, v := range es.Variants {
+		variants = append(variants, v.String())
+	}
+	return "enum " + es.Name.String() + " { " + strings.Join(variants, ", ") + " };"
+}
+
+// MatchExpression is match x { pattern => body, ... }, the arms are tried
+// in order and the first one whose pattern matches is evaluated.
+type MatchExpression struct {
+	Token   token.Token // 'match'词法单元
+	Subject Expression
+	Arms    []*MatchArm
+	Rbrace  token.Token // '}'词法单元
+}
+
+// MatchArm is pattern => body. A pattern is _, an identifier, a literal,
+// an array of patterns or an enum variant such as Ok(v), whose arguments
+// are patterns too.
+type MatchArm struct {
+	Pattern Expression
+	Body    *BlockStatement
+}
+
+func (me *MatchExpression) expressionNode()     {}
+func (me *MatchExpression) Literal() string     { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position { return me.Token.Pos }
+func (me *MatchExpression) End() token.Position { return me.Rbrace.End }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.Pattern.String()+" => "+arm.Body.String())
+	}
+	return "match " + me.Subject.String() + " { " + strings.Join(arms, ", ") + " }"
+}
+
+// RestPattern is the ..rest ending an array pattern, Name is nil for a
+// bare ..
+type RestPattern struct {
+	Token token.Token // 第一个'.'词法单元
+	Name  *Identifier
+}
+
+func (rp *RestPattern) expressionNode()     {}
+func (rp *RestPattern) Literal() string     { return rp.Token.Literal }
+func (rp *RestPattern) Pos() token.Position { return rp.Token.Pos }
+func (rp *RestPattern) End() token.Position {
+	if rp.Name != nil {
+		return rp.Name.End()
+	}
+	return rp.Token.End
+}
+func (rp *RestPattern) String() string {
+	if rp.Name != nil {
+		return ".." + rp.Name.String()
+	}
+	return ".."
+}
@@ -0,0 +1,273 @@
+package diag
+
+import (
+	"dao/token"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// Error codes: E00xx are syntax errors, E01xx are runtime errors, E02xx
+// are found by the type checker and E03xx by the resolver.
+const (
+	UnexpectedToken = "E0001"
+	NoExpression    = "E0002"
+	BadLiteral      = "E0003"
+	Unclosed        = "E0004"
+	BadBranch       = "E0005"
+	IllegalToken    = "E0006"
+	DuplicateName   = "E0007"
+
+	RuntimeError   = "E0100"
+	TypeError      = "E0101"
+	NameError      = "E0102"
+	ArityError     = "E0103"
+	DivisionByZero = "E0104"
+	IndexError     = "E0105"
+	ValueError     = "E0106"
+
+	MismatchedType = "E0200"
+	UndefinedType  = "E0201"
+	WrongArgCount  = "E0202"
+	InvalidOp      = "E0203"
+	UndefinedField = "E0204"
+	NonExhaustive  = "E0205"
+	AssignMismatch = "E0206"
+
+	UndeclaredName = "E0300"
+	ShadowedName   = "E0301"
+	AssignToConst  = "E0302"
+	Redeclared     = "E0303"
+	AssignToType   = "E0304"
+)
+
+// Diagnostic is a problem found in the source, located by the span
+// [Pos, End). Code identifies the kind of problem, eg. E0001, Hint is an
+// optional suggestion printed below the source snippet and Notes are extra
+// lines of context, such as a stack trace.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Msg      string
+	Pos      token.Position
+	End      token.Position
+	Hint     string
+	Notes    []string
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Pos.IsValid() {
+		return d.Pos.String() + ": " + d.Msg
+	}
+	return d.Msg
+}
+
+const (
+	red    = "\033[1;31m"
+	yellow = "\033[1;33m"
+	blue   = "\033[1;34m"
+	bold   = "\033[1m"
+	reset  = "\033[0m"
+)
+
+// Printer renders diagnostics against the source they were found in, with
+// the offending line and a caret under the span:
+//
+//	error[E0001]: expect next token to be ID, got = instead
+//	 --> main.dao:2:5
+//	  |
+//	2 | var = 2
+//	  |     ^
+type Printer struct {
+	out   io.Writer
+	lines []string
+	Color bool
+}
+
+// NewPrinter returns a Printer writing to out. Color is turned on only when
+// out is a terminal and NO_COLOR is not set.
+func NewPrinter(out io.Writer, src string) *Printer {
+	return &Printer{
+		out:   out,
+		lines: strings.Split(src, "\n"),
+		Color: IsTerminal(out) && os.Getenv("NO_COLOR") == "",
+	}
+}
+
+// IsTerminal reports whether w is a character device such as a TTY.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *Printer) PrintAll(ds []*Diagnostic) {
+	for _, d := range ds {
+		p.Print(d)
+	}
+}
+
+func (p *Printer) Print(d *Diagnostic) {
+	color := red
+	if d.Severity == Warning {
+		color = yellow
+	} else if d.Severity == Note {
+		color = blue
+	}
+
+	head := d.Severity.String()
+	if d.Code != "" {
+		head += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(p.out, "%s: %s\n", p.paint(color, head), p.paint(bold, d.Msg))
+
+	if !d.Pos.IsValid() {
+		p.printFooter("", d)
+		return
+	}
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(d.Pos.Line)))
+	fmt.Fprintf(p.out, "%s%s %s\n", gutter, p.paint(blue, "-->"), d.Pos)
+
+	if d.Pos.Line <= len(p.lines) {
+		line := strings.TrimRight(p.lines[d.Pos.Line-1], "\r")
+		bar := p.paint(blue, "|")
+		fmt.Fprintf(p.out, "%s %s\n", gutter, bar)
+		fmt.Fprintf(p.out, "%s %s %s\n", p.paint(blue, strconv.Itoa(d.Pos.Line)), bar, line)
+		fmt.Fprintf(p.out, "%s %s %s%s\n", gutter, bar, padding(line, d.Pos.Column), p.paint(color, carets(line, d)))
+	}
+
+	p.printFooter(gutter+" ", d)
+}
+
+func (p *Printer) printFooter(indent string, d *Diagnostic) {
+	if d.Hint != "" {
+		fmt.Fprintf(p.out, "%s%s hint: %s\n", indent, p.paint(blue, "="), d.Hint)
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(p.out, "%s%s note: %s\n", indent, p.paint(blue, "="), note)
+	}
+}
+
+func (p *Printer) paint(color, s string) string {
+	if !p.Color {
+		return s
+	}
+	return color + s + reset
+}
+
+// padding returns the blanks needed to put a caret under column col,
+// keeping tabs so that the caret lines up with the source line. Columns
+// count bytes, the blanks count the width of the runes on screen.
+func padding(line string, col int) string {
+	var out strings.Builder
+	for i := 0; i < col-1; {
+		if i >= len(line) {
+			out.WriteByte(' ')
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if r == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteString(strings.Repeat(" ", runeWidth(r)))
+		}
+		i += size
+	}
+	return out.String()
+}
+
+// carets underlines the span of d on its first line.
+func carets(line string, d *Diagnostic) string {
+	n := 1
+	if d.End.Line == d.Pos.Line && d.End.Column > d.Pos.Column {
+		n = width(line, d.Pos.Column, d.End.Column)
+	} else if d.End.Line > d.Pos.Line && len(line) >= d.Pos.Column {
+		n = width(line, d.Pos.Column, len(line)+1)
+	}
+	if n < 1 {
+		n = 1
+	}
+	return strings.Repeat("^", n)
+}
+
+// width returns the number of columns of the screen taken by line from
+// column from up to column to; past the end of the line, a column takes
+// one.
+func width(line string, from, to int) int {
+	n := 0
+	for i := from - 1; i < to-1; {
+		if i >= len(line) {
+			n++
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		n += runeWidth(r)
+		i += size
+	}
+	return n
+}
+
+// runeWidth returns the number of columns r takes on screen: none for a
+// combining mark, two for the wide runes of East Asian scripts and most
+// emoji.
+func runeWidth(r rune) int {
+	switch {
+	case r == utf8.RuneError || r < 0x300:
+		return 1
+	case unicode.Is(unicode.Mn, r):
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
+
+// Plural returns n followed by noun, with an s unless n is 1: 1 value,
+// 2 values.
+func Plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,134 @@
+package diag
+
+import (
+	"bytes"
+	"dao/token"
+	"testing"
+)
+
+func TestPrint(t *testing.T) {
+	src := "var x = 1\n\tx + foo\n"
+
+	tests := []struct {
+		d        *Diagnostic
+		expected string
+	}{
+		{
+			&Diagnostic{
+				Code: "E0100",
+				Msg:  "identifier not found: foo",
+				Pos:  token.Position{Filename: "a.dao", Line: 2, Column: 6},
+				End:  token.Position{Filename: "a.dao", Line: 2, Column: 9},
+				Hint: "declare it first",
+			},
+			"error[E0100]: identifier not found: foo\n" +
+				" --> a.dao:2:6\n" +
+				"  |\n" +
+				"2 | \tx + foo\n" +
+				"  | \t    ^^^\n" +
+				"  = hint: declare it first\n",
+		},
+		{
+			&Diagnostic{
+				Severity: Warning,
+				Msg:      "unused",
+				Pos:      token.Position{Line: 1, Column: 5},
+				End:      token.Position{Line: 2, Column: 2},
+			},
+			"warning: unused\n" +
+				" --> 1:5\n" +
+				"  |\n" +
+				"1 | var x = 1\n" +
+				"  |     ^^^^^\n",
+		},
+		{
+			&Diagnostic{Msg: "no position"},
+			"error: no position\n",
+		},
+		{
+			&Diagnostic{
+				Code:  "E0104",
+				Msg:   "DivisionByZero: integer divide by zero",
+				Pos:   token.Position{Line: 1, Column: 9},
+				End:   token.Position{Line: 1, Column: 10},
+				Notes: []string{"in f, called at 3:1"},
+			},
+			"error[E0104]: DivisionByZero: integer divide by zero\n" +
+				" --> 1:9\n" +
+				"  |\n" +
+				"1 | var x = 1\n" +
+				"  |         ^\n" +
+				"  = note: in f, called at 3:1\n",
+		},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+		p := NewPrinter(&out, src)
+		p.Print(tt.d)
+
+		if out.String() != tt.expected {
+			t.Errorf("tests[%d] - wrong output.\nexpected=\n%s\ngot=\n%s", i, tt.expected, out.String())
+		}
+	}
+}
+
+func TestPrintWideRunes(t *testing.T) {
+	src := `var s = "日本語" + "x"; s - 1`
+
+	tests := []struct {
+		d        *Diagnostic
+		expected string
+	}{
+		{
+			&Diagnostic{
+				Msg: "unsupported operator: STRING - INT",
+				Pos: token.Position{Line: 1, Column: 28},
+				End: token.Position{Line: 1, Column: 33},
+			},
+			"error: unsupported operator: STRING - INT\n" +
+				" --> 1:28\n" +
+				"  |\n" +
+				"1 | " + src + "\n" +
+				"  |                         ^^^^^\n",
+		},
+		{
+			&Diagnostic{
+				Severity: Warning,
+				Msg:      "string",
+				Pos:      token.Position{Line: 1, Column: 9},
+				End:      token.Position{Line: 1, Column: 20},
+			},
+			"warning: string\n" +
+				" --> 1:9\n" +
+				"  |\n" +
+				"1 | " + src + "\n" +
+				"  |         ^^^^^^^^\n",
+		},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+		p := NewPrinter(&out, src)
+		p.Print(tt.d)
+
+		if out.String() != tt.expected {
+			t.Errorf("tests[%d] - wrong output.\nexpected=\n%s\ngot=\n%s", i, tt.expected, out.String())
+		}
+	}
+}
+
+func TestPrintColor(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, "x")
+	if p.Color {
+		t.Fatalf("color should be off when not writing to a terminal")
+	}
+
+	p.Color = true
+	p.Print(&Diagnostic{Msg: "boom"})
+	expected := red + "error" + reset + ": " + bold + "boom" + reset + "\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+}
@@ -2,10 +2,15 @@ package eval
 
 import (
 	"dao/ast"
+	"dao/diag"
 	"dao/meta"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 var (
@@ -15,9 +20,15 @@ var (
 )
 
 var builtins = map[string]*meta.Builtin{
-	"len":  {Fn: Len},
-	"echo": {Fn: Echo},
-	"puts": {Fn: Puts},
+	"len":    {Fn: Len},
+	"echo":   {Fn: Echo},
+	"puts":   {Fn: Puts},
+	"delete": {Fn: Delete},
+	"keys":   {Fn: Keys},
+	"values": {Fn: Values},
+	"int":    {Fn: Int},
+	"float":  {Fn: Float},
+	"range":  {Fn: Range},
 }
 
 func Eval(n ast.Node, e *meta.Env) meta.Meta {
@@ -28,77 +39,194 @@ func Eval(n ast.Node, e *meta.Env) meta.Meta {
 		return Eval(n.Expression, e)
 	case *ast.IntegerLiteral:
 		return &meta.Int{Value: n.Value}
+	case *ast.FloatLiteral:
+		return &meta.Float{Value: n.Value}
 	case *ast.BooleanLiteral:
 		return nativeBool(n.Value)
 	case *ast.PrefixExpression:
 		right := Eval(n.Right, e)
-		if isError(right) {
+		if unwinds(right) {
 			return right
 		}
-		return prefixExp(n.Operator, right)
+		return locate(prefixExp(n.Operator, right), n)
 	case *ast.InfixExpression:
 		left := Eval(n.Left, e)
-		if isError(left) {
+		if unwinds(left) {
 			return left
 		}
+		if n.Operator == "&&" || n.Operator == "||" {
+			return logicalExp(n, left, e)
+		}
 		right := Eval(n.Right, e)
-		if isError(right) {
+		if unwinds(right) {
 			return right
 		}
-		return infixExp(n.Operator, left, right)
+		return locate(infixExp(n.Operator, left, right), n)
 	case *ast.BlockStatement:
 		return blockStatement(n, e)
 	case *ast.IfExpression:
-		cond := Eval(n.Condition, e)
-		if isError(cond) {
-			return cond
-		}
 		return ifExp(n, e)
+	case *ast.MatchExpression:
+		return matchExp(n, e)
 	case *ast.ReturnStatement:
 		val := Eval(n.ReturnValue, e)
-		if isError(val) {
+		if unwinds(val) {
 			return val
 		}
 		return &meta.ReturnValue{Value: val}
 	case *ast.VarStatement:
 		val := Eval(n.Value, e)
-		if isError(val) {
+		if unwinds(val) {
 			return val
 		}
-		e.Set(n.Name.Value, val)
+		names := n.Idents()
+		vals, err := unpack(val, len(names))
+		if err != nil {
+			return locate(err, n.Value)
+		}
+		for i, name := range names {
+			val := vals[i]
+			if name.Type != nil {
+				v, ok := conform(val, name.Type, e)
+				if !ok {
+					return locate(newError(meta.TypeError, "%s %s must be %s, got %s", n.Literal(), name.Value, name.Type.Value, val.Type()), n.Value)
+				}
+				val = v
+			}
+			if _, ok := e.Lookup(name.Value); ok && e.IsConst(name.Value) {
+				return locate(newError(meta.NameError, "cannot redeclare constant %s", name.Value), name)
+			}
+			e.Set(name.Value, val)
+		}
+	case *ast.ConstStatement:
+		for _, spec := range n.Specs {
+			if val := Eval(spec, e); unwinds(val) {
+				return val
+			}
+			e.SetConst(spec.Name.Value)
+		}
 	case *ast.AssignStatement:
 		val := Eval(n.Value, e)
-		if isError(val) {
+		if unwinds(val) {
 			return val
 		}
-		assign(n, val, e)
+		if n.Targets != nil {
+			return assignTuple(n, val, e)
+		}
+		if _, err := unpack(val, 1); err != nil {
+			return locate(err, n.Value)
+		}
+		op := strings.TrimSuffix(n.Operator, "=")
+		switch target := n.Target.(type) {
+		case *ast.IndexExpression:
+			return assignIndex(target, op, val, e)
+		case *ast.SelectorExpression:
+			return assignField(target, op, val, e)
+		}
+		if op != "" {
+			val = update(n.Name, op, val, e, n)
+			if isError(val) {
+				return val
+			}
+		}
+		return locate(assign(n.Name, val, e), n.Name)
+	case *ast.IncDecStatement:
+		return incDec(n, e)
 	case *ast.ForStatement:
+		if n.Range != nil {
+			return rangeStatement(n, e)
+		}
 		return forStatement(n, e)
+	case *ast.SwitchStatement:
+		return switchStatement(n, e)
+	case *ast.BreakStatement:
+		return &meta.Break{Label: label(n.Label)}
+	case *ast.ContinueStatement:
+		return &meta.Continue{Label: label(n.Label)}
 	case *ast.Identifier:
-		return identifier(n, e)
+		return locate(identifier(n, e), n)
 	case *ast.FunctionLiteral:
 		return function(n, e)
 	case *ast.CallExpression:
 		function := Eval(n.Function, e)
-		if isError(function) {
+		if unwinds(function) {
 			return function
 		}
 
 		args := expressions(n.Args, e)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && unwinds(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		fn, isFunc := function.(*meta.Func)
+		if isFunc {
+			if err := checkArgs(fn, funcName(fn, n), n, args); err != nil {
+				return err
+			}
+		}
+		res := applyFunction(function, args)
+		if isFunc && !isError(res) {
+			res = checkResult(fn, funcName(fn, n), res)
+		}
+		if isFunc && isError(res) {
+			// unwinding: each call a runtime error passes through becomes
+			// a frame of its trace, innermost first.
+			err := res.(*meta.Error)
+			err.Trace = append(err.Trace, meta.Frame{Func: funcName(fn, n), Pos: n.Pos()})
+		}
+		return locate(res, n)
 	case *ast.StringLiteral:
 		return &meta.String{Value: n.Value}
+	case *ast.ArrayLiteral:
+		elements := expressions(n.Elements, e)
+		if len(elements) == 1 && unwinds(elements[0]) {
+			return elements[0]
+		}
+		return &meta.Array{Elements: elements}
+	case *ast.TupleLiteral:
+		values := expressions(n.Elements, e)
+		if len(values) == 1 && unwinds(values[0]) {
+			return values[0]
+		}
+		return &meta.Tuple{Values: values}
+	case *ast.IndexExpression:
+		left := Eval(n.Left, e)
+		if unwinds(left) {
+			return left
+		}
+		index := Eval(n.Index, e)
+		if unwinds(index) {
+			return index
+		}
+		return locate(indexExp(left, index), n)
+	case *ast.SliceExpression:
+		return locate(sliceExp(n, e), n)
+	case *ast.HashLiteral:
+		return hashLiteral(n, e)
+	case *ast.StructLiteral:
+		return structLiteral(n, e)
+	case *ast.SelectorExpression:
+		left := Eval(n.Left, e)
+		if unwinds(left) {
+			return left
+		}
+		return locate(selector(left, n.Field.Value), n)
+	case *ast.TypeAssertion:
+		left := Eval(n.Left, e)
+		if unwinds(left) {
+			return left
+		}
+		return locate(typeAssertion(left, n.Type, e), n)
 	}
 
 	return NIL
 }
 
 func program(program *ast.Program, e *meta.Env) meta.Meta {
-	var res meta.Meta
+	if err := hoist(program.Statements, e); err != nil {
+		return err
+	}
 
+	var res meta.Meta
 	for _, stmt := range program.Statements {
 		res = Eval(stmt, e)
 
@@ -113,15 +241,52 @@ func program(program *ast.Program, e *meta.Env) meta.Meta {
 	return res
 }
 
+// hoist declares the types and enums of a list of statements, then its
+// named functions and methods, before the statements run: as for the
+// resolver and the checker, a function may be called and a method declared
+// above the statement that declares them. The function statements run again
+// in their turn, setting the same function.
+func hoist(stmts []ast.Statement, e *meta.Env) *meta.Error {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.TypeStatement:
+			e.Set(s.Name.Value, typeStatement(s))
+		case *ast.EnumStatement:
+			enumStatement(s, e)
+		}
+	}
+	for _, stmt := range stmts {
+		s, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		if fn, ok := s.Expression.(*ast.FunctionLiteral); ok && fn.Name != nil {
+			if err, ok := function(fn, e).(*meta.Error); ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scoped runs b in a new env enclosed by e, the vars b declares are gone
+// once it has run.
+func scoped(b *ast.BlockStatement, e *meta.Env) meta.Meta {
+	return blockStatement(b, meta.NewEnclosedEnv(e))
+}
+
 func blockStatement(b *ast.BlockStatement, e *meta.Env) meta.Meta {
-	var res meta.Meta
+	if err := hoist(b.Statements, e); err != nil {
+		return err
+	}
 
+	var res meta.Meta
 	for _, stmt := range b.Statements {
 		res = Eval(stmt, e)
 
 		if res != nil {
 			rt := res.Type()
-			if rt == meta.RETURN_VALUE || rt == meta.ERROR {
+			if rt == meta.RETURN_VALUE || rt == meta.ERROR || rt == meta.BREAK || rt == meta.CONTINUE {
 				return res
 			}
 		}
@@ -130,47 +295,240 @@ func blockStatement(b *ast.BlockStatement, e *meta.Env) meta.Meta {
 	return res
 }
 
+// forStatement runs the var statements of the for clauses once, then the
+// body while the last clause holds, running the other clauses after each
+// pass: for var i = 0; i = i + 1; i < 3 {}. The clauses have an env of their
+// own, and so has each pass.
 func forStatement(f *ast.ForStatement, e *meta.Env) meta.Meta {
-	var val meta.Meta
+	e = meta.NewEnclosedEnv(e)
 
-	if len(f.Condition) == 0 { // no condition
-		for {
-			val = blockStatement(f.Body, e)
-			r, ok := val.(*meta.ReturnValue)
+	var val meta.Meta
+	var cond ast.Statement
+	var post []ast.Statement
 
-			if ok {
-				return r.Value
+	for i, stmt := range f.Condition {
+		if _, ok := stmt.(*ast.VarStatement); ok {
+			if res := Eval(stmt, e); isError(res) {
+				return res
 			}
+		} else if i == len(f.Condition)-1 {
+			cond = stmt
+		} else {
+			post = append(post, stmt)
 		}
 	}
 
-	for _, stmt := range f.Condition {
-		_, ok := stmt.(*ast.VarStatement)
-		if ok {
-			Eval(stmt, e)
+	for {
+		if cond != nil {
+			c := Eval(cond, e)
+			if isError(c) {
+				return c
+			}
+			if !isTrue(c) {
+				return val
+			}
+		}
+
+		val = scoped(f.Body, e)
+		switch res := val.(type) {
+		case *meta.ReturnValue, *meta.Error:
+			return res
+		case *meta.Break:
+			if res.Label != "" && res.Label != label(f.Label) {
+				return res
+			}
+			return NIL
+		case *meta.Continue:
+			if res.Label != "" && res.Label != label(f.Label) {
+				return res
+			}
+			val = NIL
+		}
+
+		for _, stmt := range post {
+			if res := Eval(stmt, e); isError(res) {
+				return res
+			}
 		}
 	}
+}
 
-	for isTrue(Eval(f.Condition[len(f.Condition)-1], e)) {
+// switchStatement runs the first case with a value == to the tag, or a
+// true value for a switch without tag, and the default case when there is
+// none. A case ending with fallthrough goes on with the next one, an
+// unlabeled break leaves the switch.
+func switchStatement(s *ast.SwitchStatement, e *meta.Env) meta.Meta {
+	var tag meta.Meta = TRUE
+	if s.Tag != nil {
+		tag = Eval(s.Tag, e)
+		if isError(tag) {
+			return tag
+		}
+	}
 
-		val = blockStatement(f.Body, e)
-		r, ok := val.(*meta.ReturnValue)
+	run, def := -1, -1
+cases:
+	for i, c := range s.Cases {
+		if c.Values == nil {
+			def = i
+			continue
+		}
+		for _, v := range c.Values {
+			val := Eval(v, e)
+			if isError(val) {
+				return val
+			}
+			if s.Tag == nil {
+				if isTrue(val) {
+					run = i
+					break cases
+				}
+				continue
+			}
+			eq := locate(infixExp("==", tag, val), v)
+			if isError(eq) {
+				return eq
+			}
+			if isTrue(eq) {
+				run = i
+				break cases
+			}
+		}
+	}
+	if run < 0 {
+		run = def
+	}
+	if run < 0 {
+		return NIL
+	}
 
-		if ok {
-			return r.Value
+	var res meta.Meta = NIL
+	for i := run; i < len(s.Cases); i++ {
+		res = scoped(s.Cases[i].Body, e)
+		if b, ok := res.(*meta.Break); ok && b.Label == "" {
+			return NIL
 		}
+		if res != nil {
+			switch res.Type() {
+			case meta.RETURN_VALUE, meta.ERROR, meta.BREAK, meta.CONTINUE:
+				return res
+			}
+		}
+		if !s.Cases[i].Fallthrough() {
+			break
+		}
+	}
+	return res
+}
 
-		for _, stmt := range f.Condition {
-			_, ok := stmt.(*ast.VarStatement)
-			if !ok {
-				Eval(stmt, e)
+// rangeStatement runs the body of for k, v in x once per element of x: the
+// runes of a string with their byte offset, the elements of an array with
+// their index, the pairs of a hash in insertion order, or 0 to n-1 for an
+// int n. Every pass has its own env holding k and v, a closure created in
+// the body keeps the values of its pass. The elements are taken one pass at
+// a time; a hash key deleted by an earlier pass is skipped.
+func rangeStatement(f *ast.ForStatement, e *meta.Env) meta.Meta {
+	x := Eval(f.Range, e)
+	if isError(x) {
+		return x
+	}
+
+	// next returns the key and the value of the next pass, false once there
+	// are no more.
+	var next func() (meta.Meta, meta.Meta, bool)
+	switch x := x.(type) {
+	case *meta.String:
+		i := 0
+		next = func() (meta.Meta, meta.Meta, bool) {
+			if i >= len(x.Value) {
+				return nil, nil, false
+			}
+			r, size := utf8.DecodeRuneInString(x.Value[i:])
+			key := &meta.Int{Value: int64(i)}
+			i += size
+			return key, &meta.String{Value: string(r)}, true
+		}
+	case *meta.Array:
+		elements, i := x.Elements, 0
+		next = func() (meta.Meta, meta.Meta, bool) {
+			if i >= len(elements) {
+				return nil, nil, false
+			}
+			i++
+			return &meta.Int{Value: int64(i - 1)}, elements[i-1], true
+		}
+	case *meta.Hash:
+		keys := append([]meta.HashKey(nil), x.Keys...)
+		next = func() (meta.Meta, meta.Meta, bool) {
+			for ; len(keys) > 0; keys = keys[1:] {
+				if pair, ok := x.Pairs[keys[0]]; ok {
+					keys = keys[1:]
+					return pair.Key, pair.Value, true
+				}
+			}
+			return nil, nil, false
+		}
+	case *meta.Int:
+		if f.Key != nil {
+			return locate(newError(meta.TypeError, "range over INT permits only one iteration variable"), f.Value)
+		}
+		i := int64(0)
+		next = func() (meta.Meta, meta.Meta, bool) {
+			if i >= x.Value {
+				return nil, nil, false
 			}
+			i++
+			return nil, &meta.Int{Value: i - 1}, true
 		}
+	default:
+		return locate(newError(meta.TypeError, "cannot range over %s", x.Type()), f.Range)
 	}
 
+	var val meta.Meta = NIL
+	for {
+		key, value, ok := next()
+		if !ok {
+			break
+		}
+		// with a single variable, it takes the key of a hash
+		if f.Key == nil && x.Type() == meta.HASH {
+			value = key
+		}
+
+		pass := meta.NewEnclosedEnv(e)
+		if f.Key != nil && f.Key.Value != "_" {
+			pass.Set(f.Key.Value, key)
+		}
+		if f.Value.Value != "_" {
+			pass.Set(f.Value.Value, value)
+		}
+
+		val = blockStatement(f.Body, pass)
+		switch res := val.(type) {
+		case *meta.ReturnValue, *meta.Error:
+			return res
+		case *meta.Break:
+			if res.Label != "" && res.Label != label(f.Label) {
+				return res
+			}
+			return NIL
+		case *meta.Continue:
+			if res.Label != "" && res.Label != label(f.Label) {
+				return res
+			}
+			val = NIL
+		}
+	}
 	return val
 }
 
+func label(l *ast.Identifier) string {
+	if l == nil {
+		return ""
+	}
+	return l.Value
+}
+
 func nativeBool(b bool) *meta.Bool {
 	if b {
 		return TRUE
@@ -184,49 +542,70 @@ func prefixExp(op string, right meta.Meta) meta.Meta {
 		return bangOpExp(right)
 	case "-":
 		return minusOpExp(right)
+	case "~":
+		if right, ok := right.(*meta.Int); ok {
+			return &meta.Int{Value: ^right.Value}
+		}
+		return newError(meta.TypeError, "unknown operator: ~%s", right.Type())
 	default:
-		return newError("unknown operator: %s %s", op, right.Type())
+		return newError(meta.TypeError, "unknown operator: %s %s", op, right.Type())
 	}
 }
 
 func bangOpExp(right meta.Meta) meta.Meta {
-	switch right {
-	case TRUE:
+	return nativeBool(!isTrue(right))
+}
+
+// logicalExp evaluates the right operand of && and || only when the left
+// one doesn't decide the result already.
+func logicalExp(n *ast.InfixExpression, left meta.Meta, e *meta.Env) meta.Meta {
+	if n.Operator == "&&" && !isTrue(left) {
 		return FALSE
-	case FALSE:
-		return TRUE
-	case NIL:
+	}
+	if n.Operator == "||" && isTrue(left) {
 		return TRUE
-	default:
-		return nil
 	}
+
+	right := Eval(n.Right, e)
+	if unwinds(right) {
+		return right
+	}
+	return nativeBool(isTrue(right))
 }
 
 func minusOpExp(right meta.Meta) meta.Meta {
-	if right.Type() != meta.INT {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *meta.Int:
+		return &meta.Int{Value: -right.Value}
+	case *meta.Float:
+		return &meta.Float{Value: -right.Value}
+	default:
+		return newError(meta.TypeError, "unknown operator: -%s", right.Type())
 	}
-
-	val := right.(*meta.Int).Value
-	return &meta.Int{Value: -val}
 }
 
 func infixExp(op string, left meta.Meta, right meta.Meta) meta.Meta {
 	switch {
+	case op == "in":
+		return inExp(left, right)
 	case left.Type() == meta.INT && right.Type() == meta.INT:
 		return intInfixExp(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return floatInfixExp(op, left, right)
 	case left.Type() == meta.STRING && right.Type() == meta.STRING:
 		return strInfixExp(op, left, right)
 	case left.Type() == meta.STRING && right.Type() == meta.INT || left.Type() == meta.INT && right.Type() == meta.STRING:
 		return strPlusInfixExp(op, left, right)
+	case left.Type() == meta.ARRAY && right.Type() == meta.ARRAY:
+		return arrayInfixExp(op, left, right)
 	case op == "==":
-		return nativeBool(left == right)
+		return nativeBool(equals(left, right))
 	case op == "!=":
-		return nativeBool(left != right)
+		return nativeBool(!equals(left, right))
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), op, right.Type())
+		return newError(meta.TypeError, "type mismatch: %s %s %s", left.Type(), op, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newError(meta.TypeError, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
 }
 
@@ -241,20 +620,99 @@ func intInfixExp(op string, left meta.Meta, right meta.Meta) meta.Meta {
 	case "*":
 		return &meta.Int{Value: lv * rv}
 	case "/":
+		if rv == 0 {
+			return newError(meta.DivisionByZero, "integer divide by zero")
+		}
 		return &meta.Int{Value: lv / rv}
 	case "%":
+		if rv == 0 {
+			return newError(meta.DivisionByZero, "integer divide by zero")
+		}
 		return &meta.Int{Value: lv % rv}
+	case "&":
+		return &meta.Int{Value: lv & rv}
+	case "|":
+		return &meta.Int{Value: lv | rv}
+	case "^":
+		return &meta.Int{Value: lv ^ rv}
+	case "&^":
+		return &meta.Int{Value: lv &^ rv}
+	case "<<", ">>":
+		if rv < 0 {
+			return newError(meta.ValueError, "negative shift count %d", rv)
+		}
+		if rv > 63 {
+			return newError(meta.ValueError, "shift count %d out of range [0, 63]", rv)
+		}
+		if op == "<<" {
+			return &meta.Int{Value: lv << rv}
+		}
+		return &meta.Int{Value: lv >> rv}
+	case ">":
+		return nativeBool(lv > rv)
+	case "<":
+		return nativeBool(lv < rv)
+	case ">=":
+		return nativeBool(lv >= rv)
+	case "<=":
+		return nativeBool(lv <= rv)
+	case "!=":
+		return nativeBool(lv != rv)
+	case "==":
+		return nativeBool(lv == rv)
+	default:
+		return newError(meta.TypeError, "unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+}
+
+// floatInfixExp handles a float with a float or an int, the int is
+// promoted to float first.
+func floatInfixExp(op string, left meta.Meta, right meta.Meta) meta.Meta {
+	lv := toFloat(left)
+	rv := toFloat(right)
+	switch op {
+	case "+":
+		return &meta.Float{Value: lv + rv}
+	case "-":
+		return &meta.Float{Value: lv - rv}
+	case "*":
+		return &meta.Float{Value: lv * rv}
+	case "/":
+		if rv == 0 {
+			return newError(meta.DivisionByZero, "float divide by zero")
+		}
+		return &meta.Float{Value: lv / rv}
+	case "%":
+		if rv == 0 {
+			return newError(meta.DivisionByZero, "float divide by zero")
+		}
+		return &meta.Float{Value: math.Mod(lv, rv)}
 	case ">":
 		return nativeBool(lv > rv)
 	case "<":
 		return nativeBool(lv < rv)
+	case ">=":
+		return nativeBool(lv >= rv)
+	case "<=":
+		return nativeBool(lv <= rv)
 	case "!=":
 		return nativeBool(lv != rv)
 	case "==":
 		return nativeBool(lv == rv)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newError(meta.TypeError, "unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+}
+
+func isNumber(m meta.Meta) bool {
+	return m.Type() == meta.INT || m.Type() == meta.FLOAT
+}
+
+func toFloat(m meta.Meta) float64 {
+	if i, ok := m.(*meta.Int); ok {
+		return float64(i.Value)
 	}
+	return m.(*meta.Float).Value
 }
 
 func strInfixExp(op string, left meta.Meta, right meta.Meta) meta.Meta {
@@ -267,12 +725,16 @@ func strInfixExp(op string, left meta.Meta, right meta.Meta) meta.Meta {
 		return nativeBool(lv > rv)
 	case "<":
 		return nativeBool(lv < rv)
+	case ">=":
+		return nativeBool(lv >= rv)
+	case "<=":
+		return nativeBool(lv <= rv)
 	case "!=":
 		return nativeBool(lv != rv)
 	case "==":
 		return nativeBool(lv == rv)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newError(meta.TypeError, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
 }
 
@@ -299,111 +761,914 @@ func strPlusInfixExp(op string, left meta.Meta, right meta.Meta) meta.Meta {
 				return &meta.String{Value: res}
 			}
 		}
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newError(meta.TypeError, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newError(meta.TypeError, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
 }
 
-func ifExp(m *ast.IfExpression, e *meta.Env) meta.Meta {
-	cond := Eval(m.Condition, e)
-	if isTrue(cond) {
-		return Eval(m.Consequence, e)
-	} else if len(m.Options) > 0 {
-		for _, o := range m.Options {
-			c := Eval(o.Condition, e)
-			if isTrue(c) {
-				return Eval(o.Consequence, e)
-			}
-		}
-
-		if m.Alternative != nil {
-			return Eval(m.Alternative, e)
-		}
-
-		return NIL
-
-	} else if m.Alternative != nil {
-		return Eval(m.Alternative, e)
-	} else {
-		return NIL
+func arrayInfixExp(op string, left meta.Meta, right meta.Meta) meta.Meta {
+	lv := left.(*meta.Array).Elements
+	rv := right.(*meta.Array).Elements
+	switch op {
+	case "+":
+		elements := make([]meta.Meta, 0, len(lv)+len(rv))
+		elements = append(elements, lv...)
+		elements = append(elements, rv...)
+		return &meta.Array{Elements: elements}
+	case "==":
+		return nativeBool(equals(left, right))
+	case "!=":
+		return nativeBool(!equals(left, right))
+	default:
+		return newError(meta.TypeError, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
 }
 
-func identifier(m *ast.Identifier, e *meta.Env) meta.Meta {
+// equals compares values of any type: scalars by value, arrays element by
+// element, hashes pair by pair and everything else by identity.
+func equals(left meta.Meta, right meta.Meta) bool {
+	return equal(left, right, map[[2]meta.Meta]bool{})
+}
 
-	if val, ok := e.Get(m.Value); ok {
-		return val
+// equal is equals, with the pairs of containers being compared around left
+// and right in seen. Containers holding themselves compare equal once their
+// comparison comes back to a pair already in seen.
+func equal(left meta.Meta, right meta.Meta, seen map[[2]meta.Meta]bool) bool {
+	if left == right {
+		return true
 	}
-
-	if builtin, ok := builtins[m.Value]; ok {
-		return builtin
+	if isNumber(left) && isNumber(right) && left.Type() != right.Type() {
+		return toFloat(left) == toFloat(right)
+	}
+	if left.Type() != right.Type() {
+		return false
 	}
 
-	return newError("identifier not found: " + m.Value)
+	switch l := left.(type) {
+	case *meta.Int:
+		return l.Value == right.(*meta.Int).Value
+	case *meta.Float:
+		return l.Value == right.(*meta.Float).Value
+	case *meta.String:
+		return l.Value == right.(*meta.String).Value
+	case *meta.Array:
+		r := right.(*meta.Array)
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		if seen[[2]meta.Meta{l, r}] {
+			return true
+		}
+		seen[[2]meta.Meta{l, r}] = true
+		for i := range l.Elements {
+			if !equal(l.Elements[i], r.Elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *meta.Hash:
+		r := right.(*meta.Hash)
+		if len(l.Pairs) != len(r.Pairs) {
+			return false
+		}
+		if seen[[2]meta.Meta{l, r}] {
+			return true
+		}
+		seen[[2]meta.Meta{l, r}] = true
+		for k, pair := range l.Pairs {
+			other, ok := r.Pairs[k]
+			if !ok || !equal(pair.Value, other.Value, seen) {
+				return false
+			}
+		}
+		return true
+	case *meta.Variant:
+		r := right.(*meta.Variant)
+		if l.Enum != r.Enum || l.Name != r.Name {
+			return false
+		}
+		for i := range l.Values {
+			if !equal(l.Values[i], r.Values[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *meta.Struct:
+		r := right.(*meta.Struct)
+		if l.Def != r.Def {
+			return false
+		}
+		if seen[[2]meta.Meta{l, r}] {
+			return true
+		}
+		seen[[2]meta.Meta{l, r}] = true
+		for name, val := range l.Fields {
+			if !equal(val, r.Fields[name], seen) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
 }
 
-func assign(m *ast.AssignStatement, val meta.Meta, e *meta.Env) {
-	_, outer := e.GetWithEnv(m.Name.Value)
-	e.Set(m.Name.Value, val)
-	if outer != nil {
-		outer.Set(m.Name.Value, val)
+func indexExp(left meta.Meta, index meta.Meta) meta.Meta {
+	switch left := left.(type) {
+	case *meta.Array:
+		i, err := arrayIndex(left, index)
+		if err != nil {
+			return err
+		}
+		return left.Elements[i]
+	case *meta.Hash:
+		key, err := hashKey(index)
+		if err != nil {
+			return err
+		}
+		if val, ok := left.Get(key); ok {
+			return val
+		}
+		return NIL
+	default:
+		return newError(meta.TypeError, "index operator not supported: %s", left.Type())
 	}
 }
 
-func function(m *ast.FunctionLiteral, e *meta.Env) meta.Meta {
-	args := m.Args
-	body := m.Body
-	name := m.Name
-
-	funcMeta := &meta.Func{Args: args, Body: body, Env: e, Name: name}
-
-	if name != nil { // for func name  eg. func add() {} call add()
-		e.Set(name.Value, funcMeta)
+func hashKey(m meta.Meta) (meta.Hashable, *meta.Error) {
+	key, ok := m.(meta.Hashable)
+	if !ok {
+		return nil, newError(meta.TypeError, "unusable as hash key: %s", m.Type())
 	}
-
-	return funcMeta
+	return key, nil
 }
 
-func expressions(exps []ast.Expression, e *meta.Env) []meta.Meta {
-	var result []meta.Meta
+func hashLiteral(h *ast.HashLiteral, e *meta.Env) meta.Meta {
+	hash := meta.NewHash()
 
-	for _, exp := range exps {
-		res := Eval(exp, e)
-		if isError(res) {
-			return []meta.Meta{res}
+	for i, keyNode := range h.Keys {
+		key := single(Eval(keyNode, e), keyNode)
+		if unwinds(key) {
+			return key
+		}
+		hashable, err := hashKey(key)
+		if err != nil {
+			return locate(err, keyNode)
 		}
 
-		result = append(result, res)
+		val := single(Eval(h.Values[i], e), h.Values[i])
+		if unwinds(val) {
+			return val
+		}
+
+		hash.Set(hashable, val)
 	}
-	return result
+
+	return hash
 }
 
-func applyFunction(fn meta.Meta, args []meta.Meta) meta.Meta {
-	switch fn := fn.(type) {
-	case *meta.Func:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
-	case *meta.Builtin:
-		return fn.Fn(args...)
+// inExp tests the membership of a key in a hash or an element in an array.
+func inExp(left meta.Meta, right meta.Meta) meta.Meta {
+	switch right := right.(type) {
+	case *meta.Hash:
+		key, err := hashKey(left)
+		if err != nil {
+			return err
+		}
+		_, ok := right.Get(key)
+		return nativeBool(ok)
+	case *meta.Array:
+		for _, el := range right.Elements {
+			if equals(left, el) {
+				return TRUE
+			}
+		}
+		return FALSE
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(meta.TypeError, "unknown operator: %s in %s", left.Type(), right.Type())
 	}
 }
 
-func extendFunctionEnv(fn *meta.Func, args []meta.Meta) *meta.Env {
-	env := meta.NewEnclosedEnv(fn.Env)
-
-	for i, arg := range fn.Args {
-		env.Set(arg.Value, args[i])
+// arrayIndex checks index against the bounds of array, counting negative
+// indices from the end.
+func arrayIndex(array *meta.Array, index meta.Meta) (int64, *meta.Error) {
+	idx, ok := index.(*meta.Int)
+	if !ok {
+		return 0, newError(meta.TypeError, "array index must be INT, got %s", index.Type())
 	}
 
-	return env
+	i, n := idx.Value, int64(len(array.Elements))
+	if i < 0 {
+		i += n
+	}
+	if i < 0 || i >= n {
+		return 0, newError(meta.IndexError, "index out of range [%d] with length %d", idx.Value, n)
+	}
+	return i, nil
 }
 
-func unwrapReturnValue(m meta.Meta) meta.Meta {
-	if returnValue, ok := m.(*meta.ReturnValue); ok {
+func sliceExp(s *ast.SliceExpression, e *meta.Env) meta.Meta {
+	left := Eval(s.Left, e)
+	if unwinds(left) {
+		return left
+	}
+	array, ok := left.(*meta.Array)
+	if !ok {
+		return newError(meta.TypeError, "slice operator not supported: %s", left.Type())
+	}
+
+	n := int64(len(array.Elements))
+	bounds := []int64{0, n}
+	for i, exp := range []ast.Expression{s.Low, s.High} {
+		if exp == nil {
+			continue
+		}
+		val := Eval(exp, e)
+		if unwinds(val) {
+			return val
+		}
+		idx, ok := val.(*meta.Int)
+		if !ok {
+			return newError(meta.TypeError, "slice index must be INT, got %s", val.Type())
+		}
+		bounds[i] = idx.Value
+		if bounds[i] < 0 {
+			bounds[i] += n
+		}
+	}
+
+	low, high := bounds[0], bounds[1]
+	if low < 0 || high > n || low > high {
+		return newError(meta.IndexError, "slice bounds out of range [%d:%d] with length %d", low, high, n)
+	}
+
+	elements := make([]meta.Meta, high-low)
+	copy(elements, array.Elements[low:high])
+	return &meta.Array{Elements: elements}
+}
+
+// ifExp runs the first block whose condition holds, each block in an env
+// of its own. The conditions are evaluated once each, in order, up to the
+// first that holds.
+func ifExp(m *ast.IfExpression, e *meta.Env) meta.Meta {
+	cond := single(Eval(m.Condition, e), m.Condition)
+	if unwinds(cond) {
+		return cond
+	}
+	if isTrue(cond) {
+		return scoped(m.Consequence, e)
+	}
+
+	for _, o := range m.Options {
+		c := single(Eval(o.Condition, e), o.Condition)
+		if unwinds(c) {
+			return c
+		}
+		if isTrue(c) {
+			return scoped(o.Consequence, e)
+		}
+	}
+
+	if m.Alternative != nil {
+		return scoped(m.Alternative, e)
+	}
+	return NIL
+}
+
+// identifier returns the value of a name, from the env of its declaration
+// when the resolver has bound it.
+func identifier(m *ast.Identifier, e *meta.Env) meta.Meta {
+	if m.Binding != nil {
+		if val, ok := e.Ancestor(m.Binding.Depth).Lookup(m.Value); ok {
+			return val
+		}
+	} else if val, ok := e.Get(m.Value); ok {
+		return val
+	}
+
+	if builtin, ok := builtins[m.Value]; ok {
+		return builtin
+	}
+
+	return newError(meta.NameError, "identifier not found: %s", m.Value)
+}
+
+// assign stores val into the var name, which must have been declared.
+func assign(name *ast.Identifier, val meta.Meta, e *meta.Env) meta.Meta {
+	env := e
+	if name.Binding != nil {
+		env = e.Ancestor(name.Binding.Depth)
+	}
+	if env.IsConst(name.Value) {
+		return newError(meta.NameError, "cannot assign to constant %s", name.Value)
+	}
+	if !env.Assign(name.Value, val) {
+		return newError(meta.NameError, "assignment to undeclared name %s", name.Value)
+	}
+	return NIL
+}
+
+// assignTuple stores the values of val into the targets of the assignment
+// n: a, b = b, a. All the values are evaluated before the first is stored.
+func assignTuple(n *ast.AssignStatement, val meta.Meta, e *meta.Env) meta.Meta {
+	vals, err := unpack(val, len(n.Targets))
+	if err != nil {
+		return locate(err, n.Value)
+	}
+
+	for i, target := range n.Targets {
+		var res meta.Meta
+		switch target := target.(type) {
+		case *ast.IndexExpression:
+			res = assignIndex(target, "", vals[i], e)
+		case *ast.SelectorExpression:
+			res = assignField(target, "", vals[i], e)
+		case *ast.Identifier:
+			res = locate(assign(target, vals[i], e), target)
+		}
+		if isError(res) {
+			return res
+		}
+	}
+	return NIL
+}
+
+// unpack returns the n values of val, a tuple unless n is 1. It is a
+// ValueError when val doesn't hold n values.
+func unpack(val meta.Meta, n int) ([]meta.Meta, *meta.Error) {
+	values := []meta.Meta{val}
+	if tuple, ok := val.(*meta.Tuple); ok {
+		values = tuple.Values
+	}
+	if len(values) != n {
+		return nil, newError(meta.ValueError, "assignment mismatch: %s but %s", diag.Plural(n, "variable"), diag.Plural(len(values), "value"))
+	}
+	return values, nil
+}
+
+// update applies the op of a compound assignment to the current value of
+// name: x += val
+func update(name *ast.Identifier, op string, val meta.Meta, e *meta.Env, n ast.Node) meta.Meta {
+	old := locate(identifier(name, e), name)
+	if isError(old) {
+		return old
+	}
+	return locate(infixExp(op, old, val), n)
+}
+
+// incDec evaluates x++ and x--, a[i]++ and a[i]--.
+func incDec(n *ast.IncDecStatement, e *meta.Env) meta.Meta {
+	op := n.Token.Literal[:1]
+	one := &meta.Int{Value: 1}
+
+	switch target := n.Target.(type) {
+	case *ast.IndexExpression:
+		return assignIndex(target, op, one, e)
+	case *ast.SelectorExpression:
+		return assignField(target, op, one, e)
+	case *ast.Identifier:
+		val := update(target, op, one, e, n)
+		if isError(val) {
+			return val
+		}
+		return locate(assign(target, val, e), target)
+	}
+
+	return NIL
+}
+
+// assignIndex stores val into an element: a[i] = val. With an op, the
+// element is updated as in a[i] += val, left and index are evaluated once.
+func assignIndex(m *ast.IndexExpression, op string, val meta.Meta, e *meta.Env) meta.Meta {
+	left := Eval(m.Left, e)
+	if unwinds(left) {
+		return left
+	}
+	index := Eval(m.Index, e)
+	if unwinds(index) {
+		return index
+	}
+
+	if op != "" {
+		old := locate(indexExp(left, index), m)
+		if isError(old) {
+			return old
+		}
+		val = locate(infixExp(op, old, val), m)
+		if isError(val) {
+			return val
+		}
+	}
+
+	switch left := left.(type) {
+	case *meta.Array:
+		i, err := arrayIndex(left, index)
+		if err != nil {
+			return locate(err, m)
+		}
+		left.Elements[i] = val
+	case *meta.Hash:
+		key, err := hashKey(index)
+		if err != nil {
+			return locate(err, m.Index)
+		}
+		left.Set(key, val)
+	default:
+		return locate(newError(meta.TypeError, "index assignment not supported: %s", left.Type()), m)
+	}
+
+	return NIL
+}
+
+// typeStatement creates the type declared by a type statement.
+func typeStatement(n *ast.TypeStatement) meta.Meta {
+	if it, ok := n.Type.(*ast.InterfaceType); ok {
+		return &meta.InterfaceType{Name: n.Name.Value, Methods: it.Methods}
+	}
+	st := n.Type.(*ast.StructType)
+	return &meta.StructType{Name: n.Name.Value, Fields: st.Fields, Methods: map[string]*meta.Func{}}
+}
+
+// enumStatement declares the enum and its variants: a variant without a
+// payload is a value, the others are constructors.
+func enumStatement(n *ast.EnumStatement, e *meta.Env) {
+	def := &meta.EnumType{Name: n.Name.Value, Variants: n.Variants}
+	e.Set(def.Name, def)
+
+	for _, v := range n.Variants {
+		if len(v.Fields) == 0 {
+			e.Set(v.Name.Value, &meta.Variant{Enum: def, Name: v.Name.Value})
+		} else {
+			e.Set(v.Name.Value, &meta.Constructor{Enum: def, Variant: v})
+		}
+	}
+}
+
+// matchExp evaluates the body of the first arm whose pattern matches the
+// subject, nil if none does. The body runs in a new env holding the names
+// bound by the pattern.
+func matchExp(m *ast.MatchExpression, e *meta.Env) meta.Meta {
+	subject := Eval(m.Subject, e)
+	if unwinds(subject) {
+		return subject
+	}
+
+	for _, arm := range m.Arms {
+		bindings := map[string]meta.Meta{}
+		ok, err := match(arm.Pattern, subject, bindings, e)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		env := meta.NewEnclosedEnv(e)
+		for name, val := range bindings {
+			env.Set(name, val)
+		}
+		return Eval(arm.Body, env)
+	}
+
+	return NIL
+}
+
+// match reports whether m matches the pattern p, collecting the values of
+// the names p binds. _ matches anything without binding it.
+func match(p ast.Expression, m meta.Meta, bindings map[string]meta.Meta, e *meta.Env) (bool, meta.Meta) {
+	switch p := p.(type) {
+	case *ast.Identifier:
+		if p.Value == "_" {
+			return true, nil
+		}
+		switch def := variant(p.Value, e).(type) {
+		case *meta.Variant:
+			v, ok := m.(*meta.Variant)
+			return ok && v.Enum == def.Enum && v.Name == def.Name, nil
+		case *meta.Constructor:
+			return false, locate(newError(meta.ArityError, "wrong number of values in pattern %s: got 0, want %d", p.Value, len(def.Variant.Fields)), p)
+		}
+		bindings[p.Value] = m
+		return true, nil
+	case *ast.CallExpression:
+		name := p.Function.(*ast.Identifier)
+		def, ok := variant(name.Value, e).(*meta.Constructor)
+		if !ok {
+			return false, locate(newError(meta.NameError, "%s is not a variant with values", name.Value), name)
+		}
+		if len(p.Args) != len(def.Variant.Fields) {
+			return false, locate(newError(meta.ArityError, "wrong number of values in pattern %s: got %d, want %d", name.Value, len(p.Args), len(def.Variant.Fields)), p)
+		}
+		v, ok := m.(*meta.Variant)
+		if !ok || v.Enum != def.Enum || v.Name != name.Value {
+			return false, nil
+		}
+		return matchAll(p.Args, v.Values, bindings, e)
+	case *ast.ArrayLiteral:
+		array, ok := m.(*meta.Array)
+		if !ok {
+			return false, nil
+		}
+		patterns := p.Elements
+		if n := len(patterns); n > 0 {
+			if rest, ok := patterns[n-1].(*ast.RestPattern); ok {
+				patterns = patterns[:n-1]
+				if len(array.Elements) < len(patterns) {
+					return false, nil
+				}
+				if rest.Name != nil {
+					tail := make([]meta.Meta, len(array.Elements)-len(patterns))
+					copy(tail, array.Elements[len(patterns):])
+					bindings[rest.Name.Value] = &meta.Array{Elements: tail}
+				}
+				return matchAll(patterns, array.Elements[:len(patterns)], bindings, e)
+			}
+		}
+		if len(array.Elements) != len(patterns) {
+			return false, nil
+		}
+		return matchAll(patterns, array.Elements, bindings, e)
+	default:
+		val := Eval(p, e)
+		if isError(val) {
+			return false, val
+		}
+		return equals(val, m), nil
+	}
+}
+
+func matchAll(patterns []ast.Expression, values []meta.Meta, bindings map[string]meta.Meta, e *meta.Env) (bool, meta.Meta) {
+	for i, p := range patterns {
+		if ok, err := match(p, values[i], bindings, e); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// variant returns the variant or the constructor called name, nil if name
+// is not one. A variable holding a variant is not a variant name.
+func variant(name string, e *meta.Env) meta.Meta {
+	val, _ := e.Get(name)
+	switch v := val.(type) {
+	case *meta.Variant:
+		if v.Name == name && len(v.Values) == 0 {
+			return v
+		}
+	case *meta.Constructor:
+		if v.Variant.Name.Value == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// typeAssertion returns m if it is a value of the type t: s.(Circle). nil
+// is not a value of any type there, and an int is not a float.
+func typeAssertion(m meta.Meta, t *ast.Identifier, e *meta.Env) meta.Meta {
+	switch t.Value {
+	case "int", "float", "string", "bool", "array", "hash", "any":
+	default:
+		if def, ok := e.Get(t.Value); !ok || def.Type() != meta.TYPE {
+			return newError(meta.NameError, "undefined type: %s", t.Value)
+		}
+	}
+
+	if _, ok := conform(m, t, e); ok && m.Type() != meta.NIL && !(t.Value == "float" && m.Type() == meta.INT) {
+		return m
+	}
+	return newError(meta.TypeError, "type assertion failed: %s is not %s", m.Type(), t.Value)
+}
+
+// lookupStruct returns the struct type called name.
+func lookupStruct(name *ast.Identifier, e *meta.Env) (*meta.StructType, *meta.Error) {
+	val, ok := e.Get(name.Value)
+	if !ok {
+		err := newError(meta.NameError, "undefined type: %s", name.Value)
+		locate(err, name)
+		return nil, err
+	}
+	def, ok := val.(*meta.StructType)
+	if !ok {
+		err := newError(meta.TypeError, "%s is not a struct type", name.Value)
+		locate(err, name)
+		return nil, err
+	}
+	return def, nil
+}
+
+// structLiteral creates a struct, the fields left out of the literal get
+// the zero value of their type.
+func structLiteral(n *ast.StructLiteral, e *meta.Env) meta.Meta {
+	def, err := lookupStruct(n.Name, e)
+	if err != nil {
+		return err
+	}
+
+	s := &meta.Struct{Def: def, Fields: make(map[string]meta.Meta)}
+	for _, f := range def.Fields {
+		s.Fields[f.Value] = zero(f.Type)
+	}
+
+	for i, name := range n.Fields {
+		field := def.Field(name.Value)
+		if field == nil {
+			return locate(newError(meta.NameError, "unknown field %s in struct literal of type %s", name.Value, def.Name), name)
+		}
+		val := Eval(n.Values[i], e)
+		if unwinds(val) {
+			return val
+		}
+		val, err := fieldValue(s, field, val, e)
+		if err != nil {
+			return locate(err, n.Values[i])
+		}
+		s.Fields[field.Value] = val
+	}
+
+	return s
+}
+
+// zero returns the value of a field of type t that hasn't been set.
+func zero(t *ast.Identifier) meta.Meta {
+	switch t.Value {
+	case "int":
+		return &meta.Int{Value: 0}
+	case "float":
+		return &meta.Float{Value: 0}
+	case "string":
+		return &meta.String{Value: ""}
+	case "bool":
+		return FALSE
+	default:
+		return NIL
+	}
+}
+
+// fieldValue checks val against the type of the field f of s.
+func fieldValue(s *meta.Struct, f *ast.Identifier, val meta.Meta, e *meta.Env) (meta.Meta, *meta.Error) {
+	v, ok := conform(val, f.Type, e)
+	if !ok {
+		return nil, newError(meta.TypeError, "field %s of %s must be %s, got %s", f.Value, s.Def.Name, f.Type.Value, val.Type())
+	}
+	return v, nil
+}
+
+// selector returns a field of a struct, or one of its methods bound to it.
+func selector(left meta.Meta, name string) meta.Meta {
+	s, ok := left.(*meta.Struct)
+	if !ok {
+		return newError(meta.TypeError, "selector not supported: %s", left.Type())
+	}
+	if val, ok := s.Fields[name]; ok {
+		return val
+	}
+	if method, ok := s.Def.Methods[name]; ok {
+		bound := *method
+		bound.Self = s
+		return &bound
+	}
+	return newError(meta.NameError, "%s has no field or method %s", s.Def.Name, name)
+}
+
+// assignField stores val into a field of a struct: p.x = val. With an op,
+// the field is updated as in p.x += val.
+func assignField(m *ast.SelectorExpression, op string, val meta.Meta, e *meta.Env) meta.Meta {
+	left := Eval(m.Left, e)
+	if unwinds(left) {
+		return left
+	}
+	s, ok := left.(*meta.Struct)
+	if !ok {
+		return locate(newError(meta.TypeError, "field assignment not supported: %s", left.Type()), m)
+	}
+	field := s.Def.Field(m.Field.Value)
+	if field == nil {
+		return locate(newError(meta.NameError, "%s has no field %s", s.Def.Name, m.Field.Value), m)
+	}
+
+	if op != "" {
+		val = locate(infixExp(op, s.Fields[field.Value], val), m)
+		if isError(val) {
+			return val
+		}
+	}
+
+	val, err := fieldValue(s, field, val, e)
+	if err != nil {
+		return locate(err, m)
+	}
+	s.Fields[field.Value] = val
+
+	return NIL
+}
+
+// method adds fn to the methods of the struct type of its receiver.
+func method(fn *meta.Func, e *meta.Env) meta.Meta {
+	def, err := lookupStruct(fn.Receiver.Type, e)
+	if err != nil {
+		return err
+	}
+	if def.Field(fn.Name.Value) != nil {
+		return locate(newError(meta.TypeError, "field and method with the same name %s", fn.Name.Value), fn.Name)
+	}
+
+	def.Methods[fn.Name.Value] = fn
+	return fn
+}
+
+func function(m *ast.FunctionLiteral, e *meta.Env) meta.Meta {
+	args := m.Args
+	body := m.Body
+	name := m.Name
+
+	funcMeta := &meta.Func{Args: args, Body: body, Env: e, Name: name, ReturnType: m.ReturnType, ReturnTypes: m.ReturnTypes, Receiver: m.Receiver}
+
+	if m.Receiver != nil {
+		return method(funcMeta, e)
+	}
+
+	if name != nil { // for func name  eg. func add() {} call add()
+		e.Set(name.Value, funcMeta)
+	}
+
+	return funcMeta
+}
+
+// funcName names fn for stack traces, falling back on the name it was
+// called by for function literals bound to variables.
+func funcName(fn *meta.Func, call *ast.CallExpression) string {
+	if fn.Receiver != nil {
+		return fn.Receiver.Type.Value + "." + fn.Name.Value
+	}
+	if fn.Name != nil {
+		return fn.Name.Value
+	}
+	if id, ok := call.Function.(*ast.Identifier); ok {
+		return id.Value
+	}
+	return "<anonymous>"
+}
+
+func expressions(exps []ast.Expression, e *meta.Env) []meta.Meta {
+	var result []meta.Meta
+
+	for _, exp := range exps {
+		res := single(Eval(exp, e), exp)
+		if unwinds(res) {
+			return []meta.Meta{res}
+		}
+
+		result = append(result, res)
+	}
+	return result
+}
+
+// single returns m, the value of exp, where one value is expected: the
+// values of a call with several results are an error.
+func single(m meta.Meta, exp ast.Expression) meta.Meta {
+	if _, ok := m.(*meta.Tuple); ok {
+		return locate(newError(meta.TypeError, "multiple-value %s in single-value context", exp.String()), exp)
+	}
+	return m
+}
+
+// checkArgs checks the arguments of a call against the parameters of fn,
+// ints passed for float parameters are converted in args.
+func checkArgs(fn *meta.Func, name string, call *ast.CallExpression, args []meta.Meta) meta.Meta {
+	if len(args) != len(fn.Args) {
+		return locate(newError(meta.ArityError, "wrong number of arguments in call to %s: got %d, want %d", name, len(args), len(fn.Args)), call)
+	}
+
+	for i, param := range fn.Args {
+		val, ok := conform(args[i], param.Type, fn.Env)
+		if !ok {
+			err := newError(meta.TypeError, "argument %s of %s must be %s, got %s", param.Value, name, param.Type.Value, val.Type())
+			return locate(err, call.Args[i])
+		}
+		args[i] = val
+	}
+	return nil
+}
+
+// checkResult checks the value returned by fn against its return type, or
+// the values against its result types.
+func checkResult(fn *meta.Func, name string, res meta.Meta) meta.Meta {
+	tuple, isTuple := res.(*meta.Tuple)
+	got := 1
+	if isTuple {
+		got = len(tuple.Values)
+	}
+
+	if fn.ReturnTypes != nil {
+		if got != len(fn.ReturnTypes) {
+			return newError(meta.TypeError, "%s must return %s, got %d", name, diag.Plural(len(fn.ReturnTypes), "value"), got)
+		}
+		for i, t := range fn.ReturnTypes {
+			val, ok := conform(tuple.Values[i], t, fn.Env)
+			if !ok {
+				return newError(meta.TypeError, "result %d of %s must be %s, got %s", i+1, name, t.Value, val.Type())
+			}
+			tuple.Values[i] = val
+		}
+		return tuple
+	}
+
+	if isTuple && fn.ReturnType != nil {
+		return newError(meta.TypeError, "%s must return 1 value, got %d", name, got)
+	}
+	val, ok := conform(res, fn.ReturnType, fn.Env)
+	if !ok {
+		return newError(meta.TypeError, "%s must return %s, got %s", name, fn.ReturnType.Value, val.Type())
+	}
+	return val
+}
+
+// conform returns m as a value of the annotated type t, ok is false when
+// m can't be one. An int is converted for a float, nil is a valid array,
+// hash or struct. Struct and interface type names are looked up in e, a
+// struct is a value of an interface when it has all its methods. Other
+// type names the runtime doesn't know are not checked. A missing value, the
+// result of an empty function, is nil.
+func conform(m meta.Meta, t *ast.Identifier, e *meta.Env) (val meta.Meta, ok bool) {
+	if m == nil {
+		m = NIL
+	}
+	if t == nil {
+		return m, true
+	}
+
+	switch t.Value {
+	case "int":
+		return m, m.Type() == meta.INT
+	case "float":
+		if i, isInt := m.(*meta.Int); isInt {
+			return &meta.Float{Value: float64(i.Value)}, true
+		}
+		return m, m.Type() == meta.FLOAT
+	case "string":
+		return m, m.Type() == meta.STRING
+	case "bool":
+		return m, m.Type() == meta.BOOL
+	case "array":
+		return m, m.Type() == meta.ARRAY || m.Type() == meta.NIL
+	case "hash":
+		return m, m.Type() == meta.HASH || m.Type() == meta.NIL
+	case "any":
+		return m, true
+	default:
+		s, isStruct := m.(*meta.Struct)
+		def, _ := e.Get(t.Value)
+		switch def := def.(type) {
+		case *meta.StructType:
+			return m, isStruct && s.Def.Name == def.Name || m.Type() == meta.NIL
+		case *meta.InterfaceType:
+			return m, isStruct && def.Missing(s.Def) == "" || m.Type() == meta.NIL
+		case *meta.EnumType:
+			v, isVariant := m.(*meta.Variant)
+			return m, isVariant && v.Enum == def
+		}
+		if isStruct {
+			return m, s.Def.Name == t.Value
+		}
+		return m, true
+	}
+}
+
+func applyFunction(fn meta.Meta, args []meta.Meta) meta.Meta {
+	switch fn := fn.(type) {
+	case *meta.Func:
+		extendedEnv := extendFunctionEnv(fn, args)
+		evaluated := Eval(fn.Body, extendedEnv)
+		return unwrapReturnValue(evaluated)
+	case *meta.Builtin:
+		return fn.Fn(args...)
+	case *meta.Constructor:
+		name := fn.Variant.Name.Value
+		if len(args) != len(fn.Variant.Fields) {
+			return newError(meta.ArityError, "wrong number of arguments in call to %s: got %d, want %d", name, len(args), len(fn.Variant.Fields))
+		}
+		return &meta.Variant{Enum: fn.Enum, Name: name, Values: args}
+	default:
+		return newError(meta.TypeError, "not a function: %s", fn.Type())
+	}
+}
+
+func extendFunctionEnv(fn *meta.Func, args []meta.Meta) *meta.Env {
+	env := meta.NewEnclosedEnv(fn.Env)
+
+	if fn.Self != nil {
+		env.Set(fn.Receiver.Value, fn.Self)
+	}
+	for i, arg := range fn.Args {
+		env.Set(arg.Value, args[i])
+	}
+
+	return env
+}
+
+func unwrapReturnValue(m meta.Meta) meta.Meta {
+	if returnValue, ok := m.(*meta.ReturnValue); ok {
 		return returnValue.Value
 	}
 
@@ -431,20 +1696,48 @@ func isError(m meta.Meta) bool {
 	return false
 }
 
-func newError(format string, a ...interface{}) *meta.Error {
-	return &meta.Error{Msg: fmt.Sprintf(format, a...)}
+// unwinds reports whether m, the value of an expression, ends the evaluation
+// of what is around it: an error, or a return, break or continue from an if
+// or a match on its way to its function or loop, as in var x = if c { break }.
+func unwinds(m meta.Meta) bool {
+	if m == nil {
+		return false
+	}
+
+	switch m.Type() {
+	case meta.ERROR, meta.RETURN_VALUE, meta.BREAK, meta.CONTINUE:
+		return true
+	}
+	return false
+}
+
+// locate attaches the span of n to m if m is an error that has no position
+// yet, so errors point at the innermost node that produced them.
+func locate(m meta.Meta, n ast.Node) meta.Meta {
+	if err, ok := m.(*meta.Error); ok && !err.Pos.IsValid() {
+		err.Pos, err.End = n.Pos(), n.End()
+	}
+	return m
+}
+
+func newError(kind meta.ErrorKind, format string, a ...interface{}) *meta.Error {
+	return &meta.Error{Kind: kind, Msg: fmt.Sprintf(format, a...)}
 }
 
 func Len(args ...meta.Meta) meta.Meta {
 	if l := len(args); l != 1 {
-		return newError("wrong number of arguments. got=%d, want=%d", l, 1)
+		return newError(meta.ArityError, "wrong number of arguments. got=%d, want=%d", l, 1)
 	}
 
 	switch arg := args[0].(type) {
 	case *meta.String:
 		return &meta.Int{Value: int64(len(arg.Value))}
+	case *meta.Array:
+		return &meta.Int{Value: int64(len(arg.Elements))}
+	case *meta.Hash:
+		return &meta.Int{Value: int64(len(arg.Pairs))}
 	default:
-		return newError("argument to `len` not supported yet, got %s", arg.Type())
+		return newError(meta.TypeError, "argument to `len` not supported yet, got %s", arg.Type())
 	}
 }
 
@@ -468,3 +1761,126 @@ func Echo(args ...meta.Meta) meta.Meta {
 
 	return NIL
 }
+
+// Int converts a float, string or bool to int, floats are truncated toward
+// zero: int(2.7) == 2
+func Int(args ...meta.Meta) meta.Meta {
+	if l := len(args); l != 1 {
+		return newError(meta.ArityError, "wrong number of arguments. got=%d, want=%d", l, 1)
+	}
+
+	switch arg := args[0].(type) {
+	case *meta.Int:
+		return arg
+	case *meta.Float:
+		if math.IsNaN(arg.Value) || arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+			return newError(meta.ValueError, "cannot convert %s to int", arg.Echo())
+		}
+		return &meta.Int{Value: int64(arg.Value)}
+	case *meta.String:
+		val, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+		if err != nil {
+			return newError(meta.ValueError, "cannot convert %q to int", arg.Value)
+		}
+		return &meta.Int{Value: val}
+	case *meta.Bool:
+		if arg.Value {
+			return &meta.Int{Value: 1}
+		}
+		return &meta.Int{Value: 0}
+	default:
+		return newError(meta.TypeError, "argument to `int` not supported, got %s", arg.Type())
+	}
+}
+
+// Float converts an int or string to float: float(1) == 1.0
+func Float(args ...meta.Meta) meta.Meta {
+	if l := len(args); l != 1 {
+		return newError(meta.ArityError, "wrong number of arguments. got=%d, want=%d", l, 1)
+	}
+
+	switch arg := args[0].(type) {
+	case *meta.Float:
+		return arg
+	case *meta.Int:
+		return &meta.Float{Value: float64(arg.Value)}
+	case *meta.String:
+		val, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+		if err != nil {
+			return newError(meta.ValueError, "cannot convert %q to float", arg.Value)
+		}
+		return &meta.Float{Value: val}
+	default:
+		return newError(meta.TypeError, "argument to `float` not supported, got %s", arg.Type())
+	}
+}
+
+// Range returns the array of the ints from start up to end, excluded:
+// range(end) starts at 0, range(start, end).
+func Range(args ...meta.Meta) meta.Meta {
+	if l := len(args); l != 1 && l != 2 {
+		return newError(meta.ArityError, "wrong number of arguments. got=%d, want=1 or 2", l)
+	}
+
+	bounds := []int64{0}
+	for _, arg := range args {
+		n, ok := arg.(*meta.Int)
+		if !ok {
+			return newError(meta.TypeError, "argument to `range` must be INT, got %s", arg.Type())
+		}
+		bounds = append(bounds, n.Value)
+	}
+	start, end := bounds[len(bounds)-2], bounds[len(bounds)-1]
+
+	elements := []meta.Meta{}
+	for i := start; i < end; i++ {
+		elements = append(elements, &meta.Int{Value: i})
+	}
+	return &meta.Array{Elements: elements}
+}
+
+// Delete removes a key from a hash: delete(h, key)
+func Delete(args ...meta.Meta) meta.Meta {
+	if l := len(args); l != 2 {
+		return newError(meta.ArityError, "wrong number of arguments. got=%d, want=%d", l, 2)
+	}
+
+	hash, ok := args[0].(*meta.Hash)
+	if !ok {
+		return newError(meta.TypeError, "first argument to `delete` must be HASH, got %s", args[0].Type())
+	}
+	key, err := hashKey(args[1])
+	if err != nil {
+		return err
+	}
+
+	hash.Delete(key)
+	return NIL
+}
+
+// Keys returns the keys of a hash as an array, in insertion order.
+func Keys(args ...meta.Meta) meta.Meta {
+	return hashElements("keys", args, func(pair meta.HashPair) meta.Meta { return pair.Key })
+}
+
+// Values returns the values of a hash as an array, in insertion order.
+func Values(args ...meta.Meta) meta.Meta {
+	return hashElements("values", args, func(pair meta.HashPair) meta.Meta { return pair.Value })
+}
+
+func hashElements(name string, args []meta.Meta, pick func(meta.HashPair) meta.Meta) meta.Meta {
+	if l := len(args); l != 1 {
+		return newError(meta.ArityError, "wrong number of arguments. got=%d, want=%d", l, 1)
+	}
+
+	hash, ok := args[0].(*meta.Hash)
+	if !ok {
+		return newError(meta.TypeError, "argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+
+	elements := []meta.Meta{}
+	for _, pair := range hash.Ordered() {
+		elements = append(elements, pick(pair))
+	}
+	return &meta.Array{Elements: elements}
+}
@@ -4,6 +4,8 @@ import (
 	"dao/lexer"
 	"dao/meta"
 	"dao/parser"
+	"dao/resolver"
+	"dao/token"
 	"testing"
 )
 
@@ -78,6 +80,93 @@ if 10 > 1 {
 		}
 	}
 }
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		pos, end string
+	}{
+		{"var a = 1\na + foo", "2:5", "2:8"},
+		{"5 + true", "1:1", "1:9"},
+		{"func f() { -true }\nf()", "1:12", "1:17"},
+		{`len(1)`, "1:1", "1:7"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		err, ok := evaluated.(*meta.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if err.Pos.String() != tt.pos || err.End.String() != tt.end {
+			t.Errorf("wrong error span for %q. expected=%s-%s, got=%s-%s",
+				tt.input, tt.pos, tt.end, err.Pos, err.End)
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input string
+		kind  meta.ErrorKind
+	}{
+		{"foobar", meta.NameError},
+		{"5 + true", meta.TypeError},
+		{"-true", meta.TypeError},
+		{`len("a", "b")`, meta.ArityError},
+		{"1 / 0", meta.DivisionByZero},
+		{"7 % (2 - 2)", meta.DivisionByZero},
+		{"var a = 1; a()", meta.TypeError},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		err, ok := evaluated.(*meta.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if err.Kind != tt.kind {
+			t.Errorf("wrong error kind for %q. expected=%s, got=%s", tt.input, tt.kind, err.Kind)
+		}
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	input := `func walk(n int) {
+  if n == 0 {
+    return missing
+  }
+  walk(n - 1)
+}
+var start = func() { walk(2) }
+start()`
+
+	evaluated := testEval(input)
+	err, ok := evaluated.(*meta.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := []string{"walk 5:3", "walk 5:3", "walk 7:22", "start 8:1"}
+	if len(err.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. expected=%d, got=%d (%+v)", len(expected), len(err.Trace), err.Trace)
+	}
+	for i, frame := range err.Trace {
+		got := frame.Func + " " + frame.Pos.String()
+		if got != expected[i] {
+			t.Errorf("trace[%d] wrong. expected=%q, got=%q", i, expected[i], got)
+		}
+	}
+
+	if err.Pos.String() != "3:12" {
+		t.Errorf("error should point at the failing node, got %s", err.Pos)
+	}
+}
+
 func TestEvalIntExp(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -132,6 +221,22 @@ func TestEvalBoolExp(t *testing.T) {
 		{"(1 > 2) == false", true},
 		{"(1 > 2) == (2 > 3)", true},
 		{"false == (1 > 2)", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"2.5 >= 2", true},
+		{`"a" <= "b"`, true},
+		{`"b" >= "c"`, false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"nil || 0", true},
+		{`"" && nil`, false},
+		{"[1] && 1", true},
+		{"false || nil", false},
 	}
 
 	for _, tt := range tests {
@@ -149,6 +254,10 @@ func TestBangOp(t *testing.T) {
 		{"!true", false},
 		{"!!false", false},
 		{"!!true", true},
+		{"!nil", true},
+		{"!5", false},
+		{"!1.5", false},
+		{`!"a"`, false},
 	}
 
 	for _, tt := range tests {
@@ -285,6 +394,225 @@ for x < 10 {
 	}
 }
 
+func TestBreakContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+var x = 0
+for {
+	x = x + 1
+	if x == 5 {
+		break
+	}
+}
+x`, 5},
+		{`
+var x = 0
+var sum = 0
+for x < 10 {
+	x = x + 1
+	if x % 2 == 0 {
+		continue
+	}
+	sum = sum + x
+}
+sum`, 25},
+		{`
+var sum = 0
+for var i = 0; i = i + 1; i < 10 {
+	if i == 3 { continue }
+	if i == 6 { break }
+	sum = sum + i
+}
+sum`, 12},
+		{`
+var hits = 0
+outer: for var i = 0; i = i + 1; i < 5 {
+	for var j = 0; j = j + 1; j < 5 {
+		if j == 2 { continue outer }
+		if i == 3 { break outer }
+		hits = hits + 1
+	}
+}
+hits`, 6},
+		{`
+func find() {
+	var n = 0
+	for {
+		n = n + 1
+		if n > 3 { return n * 10 }
+	}
+	return 0
+}
+find()`, 40},
+		{"var n = 0; for n < 3 { n++; var x = if n == 1 { break }; n += 10 }; n", 1},
+		{"var n = 0; var s = 0; for n < 3 { n++; s = if n == 2 { continue } else { s + n } }; s", 4},
+		{"var s = 0; for var i = 0; i++; i < 5 { s += match i { 3 => { break }, _ => i } }; s", 3},
+		{"var s = 0; for var i = 0; i++; i < 3 { s += len([if i == 1 { continue }]) }; s", 2},
+		{"func f() { for { var x = 1 + if true { return 7 } } }; f()", 7},
+	}
+
+	for _, tt := range tests {
+		testIntMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSwitchStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`switch 2 { case 1: "one"; case 2, 3: "two or three"; default: "many" }`, "two or three"},
+		{`switch 5 { case 1: "one"; default: "many" }`, "many"},
+		{`switch 5 { default: "many"; case 5: "five" }`, "five"},
+		{`switch 5 { case 1: "one" }`, nil},
+		{`var x = 7; switch { case x < 5: "small"; case x < 10: "medium"; default: "large" }`, "medium"},
+		{`var s = ""; switch 1 { case 1: s += "a"; fallthrough; case 2: s += "b"; fallthrough; case 3: s += "c"; case 4: s += "d" }; s`, "abc"},
+		{`var s = ""; switch 9 { default: s += "d"; fallthrough; case 1: s += "1" }; s`, "d1"},
+		{`switch 1.0 { case 1: "int equals float" }`, "int equals float"},
+		{`switch [1, 2] { case [1, 2]: "same array" }`, "same array"},
+		{`switch "a" { case "b": 1; case "a": 2 }`, 2},
+		{`var n = 0; switch 1 { case 1: n = 1; break; n = 2 }; n`, 1},
+		{`var n = 0; for var i = 0; i++; i < 5 { switch i { case 2: continue; case 4: break }; n += i }; n`, 8},
+		{`var n = 0; outer: for { switch n { case 3: break outer }; n++ }; n`, 3},
+		{`func f(x int) { switch x { case 1: return "one" }; "other" }; f(1) + f(2)`, "oneother"},
+		{`var calls = 0; func one() { calls++; 1 }; switch 1 { case one(): 0; case one(): 0 }; calls`, 1},
+		{`switch "a" { case 1: 0 }`, errorMeta(meta.TypeError, "unknown operator: STRING == INT")},
+		{`switch y { default: 0 }`, errorMeta(meta.NameError, "identifier not found: y")},
+		{`switch 1 { case 1: 1 / 0 }`, errorMeta(meta.DivisionByZero, "integer divide by zero")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRangeStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`var s = 0; for v in [1, 2, 3] { s += v }; s`, 6},
+		{`var s = 0; for i, v in [10, 20] { s += i * v }; s`, 20},
+		{`var out = ""; for i, c in "héllo" { out += c + "" }; out`, "héllo"},
+		{`var idx = []; for i, c in "hé!" { idx = idx + [i] }; idx`, []interface{}{0, 1, 3}},
+		{`var h = {"b": 1, "a": 2, "c": 3}; var ks = ""; for k in h { ks += k }; ks`, "bac"},
+		{`var h = {"b": 1, "a": 2}; var s = ""; for k, v in h { s += k * v }; s`, "baa"},
+		{`var s = 0; for i in 4 { s += i }; s`, 6},
+		{`var n = 0; for i in -1 { n++ }; n`, 0},
+		{`range(3)`, []interface{}{0, 1, 2}},
+		{`range(2, 5)`, []interface{}{2, 3, 4}},
+		{`var s = 0; for i in range(1, 4) { s += i }; s`, 6},
+		{`var n = 0; for i in 1_000_000_000_000 { if i == 2 { break }; n++ }; n`, 2},
+		{`var h = {"a": 1, "b": 2, "c": 3}; var ks = ""; for k in h { ks += k; delete(h, "b") }; ks`, "ac"},
+		{`var h = {"a": 1, "b": 2}; var s = 0; for k, v in h { h["b"] = 5; s += v }; s`, 6},
+		{`var fs = []; for i, v in [1, 2, 3] { fs = fs + [func() { i * 10 + v }] }; fs[0]() + fs[2]()`, 24},
+		{`var s = 0; for _, v in [1, 2, 3, 4, 5] { if v == 2 { continue }; if v == 4 { break }; s += v }; s`, 4},
+		{`var n = 0; outer: for i in 3 { for j in 3 { if j == 1 { continue outer }; n++ } }; n`, 3},
+		{`func first(a array) { for _, v in a { if v > 1 { return v } }; 0 }; first([1, 5, 7])`, 5},
+		{`func sum(a array) { var t = 0; for v in a { t += v }; t }; sum([1, 2])`, 3},
+		{`var a = [1, 2]; for v in a { a = a + [v] }; a`, []interface{}{1, 2, 1, 2}},
+		{`for v in [1] { var inner = v }; inner`, errorMeta(meta.NameError, "identifier not found: inner")},
+		{`for v in 1.5 {}`, errorMeta(meta.TypeError, "cannot range over FLOAT")},
+		{`for i, v in 3 {}`, errorMeta(meta.TypeError, "range over INT permits only one iteration variable")},
+		{`range("a")`, errorMeta(meta.TypeError, "argument to `range` must be INT, got STRING")},
+		{`range()`, errorMeta(meta.ArityError, "wrong number of arguments. got=0, want=1 or 2")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`if true { var x = 1 }; x`, errorMeta(meta.NameError, "identifier not found: x")},
+		{`var x = 1; if true { var x = 2; x = 3 }; x`, 1},
+		{`var x = 1; if true { x = 2 }; x`, 2},
+		{`var s = 0; for var i = 0; i++; i < 3 { var t = i; s += t }; s`, 3},
+		{`for var i = 0; i++; i < 3 {}; i`, errorMeta(meta.NameError, "identifier not found: i")},
+		{`var n = 0; switch 1 { case 1: var n = 5 }; n`, 0},
+		{`var x = "global"; func f() { x }; func g() { var x = "local"; f() }; g()`, "global"},
+		{`func f() { var x = 1; if true { var x = 2; x++ }; x }; f()`, 1},
+		{`func f() { var x = 1; func() { x = 5 }() ; x }; f()`, 5},
+		{`func f() { g() }; func g() { 7 }; f()`, 7},
+		{`y = 1`, errorMeta(meta.NameError, "assignment to undeclared name y")},
+		{`y++`, errorMeta(meta.NameError, "identifier not found: y")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMultipleValues(t *testing.T) {
+	divmod := "func divmod(a int, b int) (int, int) { return a / b, a % b }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{divmod + "var q, r = divmod(7, 2); [q, r]", []interface{}{3, 1}},
+		{`var a, b = 1, "b"; [a, b]`, []interface{}{1, "b"}},
+		{`var a, b = 1, 2; a, b = b, a; [a, b]`, []interface{}{2, 1}},
+		{`var a = [1, 2]; var h = {}; a[0], h["k"] = a[1], a[0]; [a, h["k"]]`, []interface{}{[]interface{}{2, 2}, 1}},
+		{`type P struct { x int; y int }; var p = P{}; p.x, p.y = 3, 4; [p.x, p.y]`, []interface{}{3, 4}},
+		{`func pair() { return "a", 1 }; var s, n = pair(); s * n`, "a"},
+		{`func f() { var a, b = 1, 2; if true { var a, c = 3, 4; b = a + c }; return [a, b] }; f()`, []interface{}{1, 7}},
+		{`var x, y float = 1, 2.5; x + y`, 3.5},
+		{`type S interface { two() (int, int) }; type T struct {}; func (t T) two() (int, int) { return 1, 2 }; var s S = T{}; var a, b = s.two(); a + b`, 3},
+		{divmod + "var a, b, c = divmod(7, 2)", errorMeta(meta.ValueError, "assignment mismatch: 3 variables but 2 values")},
+		{divmod + "var t = divmod(7, 2)", errorMeta(meta.ValueError, "assignment mismatch: 1 variable but 2 values")},
+		{`var a, b = 1`, errorMeta(meta.ValueError, "assignment mismatch: 2 variables but 1 value")},
+		{`var a = 1; var b = 2; a, b = 1, 2, 3`, errorMeta(meta.ValueError, "assignment mismatch: 2 variables but 3 values")},
+		{`var a = 1; a = 1, 2`, errorMeta(meta.ValueError, "assignment mismatch: 1 variable but 2 values")},
+		{`func f() (int, int) { return 1 }; f()`, errorMeta(meta.TypeError, "f must return 2 values, got 1")},
+		{`func f() (int, string) { return 1, 2 }; f()`, errorMeta(meta.TypeError, "result 2 of f must be string, got INT")},
+		{`var x, y int = 1, "a"`, errorMeta(meta.TypeError, "var y must be int, got STRING")},
+		{divmod + "puts(divmod(7, 2))", errorMeta(meta.TypeError, "multiple-value divmod(7, 2) in single-value context")},
+		{divmod + "var a = [1, divmod(7, 2)]", errorMeta(meta.TypeError, "multiple-value divmod(7, 2) in single-value context")},
+		{divmod + `{"k": divmod(7, 2)}`, errorMeta(meta.TypeError, "multiple-value divmod(7, 2) in single-value context")},
+		{divmod + `if divmod(7, 2) { 1 }`, errorMeta(meta.TypeError, "multiple-value divmod(7, 2) in single-value context")},
+		{divmod + `if false { 1 } else if divmod(7, 2) { 2 } else { 3 }`, errorMeta(meta.TypeError, "multiple-value divmod(7, 2) in single-value context")},
+		{`var n = 0; func tick() { n += 1; n > 1 }; if tick() { 1 } else if tick() { 2 }; n`, 2},
+		{`func f() { return 1, 2 }; func g() int { f() }; g()`, errorMeta(meta.TypeError, "g must return 1 value, got 2")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+
+	if echo := testEval(divmod + "divmod(9, 4)").Echo(); echo != "(2, 1)" {
+		t.Errorf("wrong echo. expected=%q, got=%q", "(2, 1)", echo)
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`const a = 2; a * 3`, 6},
+		{"const (\n  a = 1\n  b = a + 1\n)\n[a, b]", []interface{}{1, 2}},
+		{`const a = [1]; a[0] = 5; a`, []interface{}{5}},
+		{`func f() { const k = 3; k }; f()`, 3},
+		{`const a = 1; a = 2`, errorMeta(meta.NameError, "cannot assign to constant a")},
+		{`const a = 1; a += 1`, errorMeta(meta.NameError, "cannot assign to constant a")},
+		{`const a = 1; a++`, errorMeta(meta.NameError, "cannot assign to constant a")},
+		{`const a = 1; func f() { a = 2 }; f()`, errorMeta(meta.NameError, "cannot assign to constant a")},
+		{`const a = 1; var a = 2; a = 3; a`, errorMeta(meta.NameError, "cannot redeclare constant a")},
+		{`const a int = "x"`, errorMeta(meta.TypeError, "const a must be int, got STRING")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestVarStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -312,6 +640,14 @@ func TestAssignStatements(t *testing.T) {
 		{"var a = 5; var b = a; b = a + b; b", 10},
 		{"var a = 5; var b = a; var c = a + b + 5; c = c + 5; c", 20},
 		{"func a() { var b = 1; return func(x int) { b = b + x; return b;}}; var c = a(); c(1); c(1)", 3},
+		{"var a = 5; a += 3; a", 8},
+		{"var a = 5; a -= 3; a *= 4; a", 8},
+		{"var a = 17; a /= 2; a %= 5; a", 3},
+		{"var a = 1; a++; a++; a--; a", 2},
+		{"var s = 0; for var i = 0; i++; i < 5 { s += i }; s", 10},
+		{"var a = [1, 2]; a[0] += 10; a[-1]++; a[0] + a[1]", 14},
+		{`var h = {"n": 1}; h["n"] *= 5; h["n"]--; h["n"]`, 4},
+		{"func a() { var b = 1; return func() { b += 1; b }}; var c = a(); c(); c()", 3},
 	}
 
 	for _, tt := range tests {
@@ -344,6 +680,37 @@ func TestFuncMeta(t *testing.T) {
 	}
 }
 
+func TestFunctionArityAndTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+		pos      string
+	}{
+		{"func add(x int, y int) int { x + y }; add(1)", errorMeta(meta.ArityError, "wrong number of arguments in call to add: got 1, want 2"), "1:39"},
+		{"var f = func() { 1 }; f(1, 2)", errorMeta(meta.ArityError, "wrong number of arguments in call to f: got 2, want 0"), "1:23"},
+		{`func add(x int, y int) int { x + y }; add(1, "2")`, errorMeta(meta.TypeError, "argument y of add must be int, got STRING"), "1:46"},
+		{"func half(x float) float { x / 2 }; half(3)", 1.5, ""},
+		{"func f(a array, h hash) { len(a) + len(h) }; f([1], nil)", errorMeta(meta.TypeError, "argument to `len` not supported yet, got NIL"), "1:36"},
+		{"func f(s string) int { len(s) * 1.5 }; f(\"ab\")", errorMeta(meta.TypeError, "f must return int, got FLOAT"), "1:40"},
+		{"func f() int { return nil }; f()", errorMeta(meta.TypeError, "f must return int, got NIL"), "1:30"},
+		{"func f() float { 1 }; f()", 1.0, ""},
+		{"func f(x any) bool { x != nil }; f(\"a\")", true, ""},
+		{"func f(x bool) {}; f(1)", errorMeta(meta.TypeError, "argument x of f must be bool, got INT"), "1:22"},
+		{"func f() int {}; f()", errorMeta(meta.TypeError, "f must return int, got NIL"), "1:18"},
+		{"func g() {}; func h(x int) int { return x }; h(g())", errorMeta(meta.TypeError, "argument x of h must be int, got NIL"), "1:48"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testMeta(t, evaluated, tt.expected) {
+			continue
+		}
+		if err, ok := evaluated.(*meta.Error); ok && err.Pos.String() != tt.pos {
+			t.Errorf("wrong position for %q. expected=%s, got=%s", tt.input, tt.pos, err.Pos)
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -377,6 +744,95 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestCompoundAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"x += 1", errorMeta(meta.NameError, "identifier not found: x")},
+		{"y++", errorMeta(meta.NameError, "identifier not found: y")},
+		{`var s = "a"; s += 1`, errorMeta(meta.TypeError, "unknown operator: STRING + INT")},
+		{`var s = "a"; s++`, errorMeta(meta.TypeError, "unknown operator: STRING + INT")},
+		{"var a = 1; a /= 0", errorMeta(meta.DivisionByZero, "integer divide by zero")},
+		{`var h = {}; h["k"]++`, errorMeta(meta.TypeError, "type mismatch: NIL + INT")},
+		{"var a = [1]; a[3] += 1", errorMeta(meta.IndexError, "index out of range [3] with length 1")},
+		{`var s = "ab"; s += "c"; s`, "abc"},
+		{"var f = 1.5; f *= 2; f", 3.0},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"12 &^ 10", 4},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"~0", -1},
+		{"~5 & 255", 250},
+		{"1 << 63", -9223372036854775808},
+		{"1 | 2 ^ 3 & 4", 3},
+		{"var flags = 0; flags = flags | 1 << 3; flags & 8 != 0", true},
+		{"1 << -1", errorMeta(meta.ValueError, "negative shift count -1")},
+		{"1 >> 64", errorMeta(meta.ValueError, "shift count 64 out of range [0, 63]")},
+		{"1.5 & 1", errorMeta(meta.TypeError, "unknown operator: FLOAT & INT")},
+		{"~true", errorMeta(meta.TypeError, "unknown operator: ~BOOL")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"false && missing", false},
+		{"true || missing", true},
+		{"true && 1 / 0", errorMeta(meta.DivisionByZero, "integer divide by zero")},
+		{"var n = 0; var inc = func() { n = n + 1; true }; false && inc(); true || inc(); n", 0},
+		{"var n = 0; var inc = func() { n = n + 1; true }; true && inc(); false || inc(); n", 2},
+		{"false || missing", errorMeta(meta.NameError, "identifier not found: missing")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"a\tb"`, "a\tb"},
+		{`"\"quoted\""`, `"quoted"`},
+		{`len("\u{e9}")`, 2},
+		{"`two\nlines`", "two\nlines"},
+		{"`no \\n escape` + \"!\"", `no \n escape!`},
+		{`["a\nb"]`, []interface{}{"a\nb"}},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+
+	// the elements of an array echo with their escapes
+	if echo := testEval(`["a\nb"]`).Echo(); echo != `["a\nb"]` {
+		t.Errorf("wrong echo. expected=%q, got=%q", `["a\nb"]`, echo)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 
@@ -466,6 +922,484 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestBuiltinNames(t *testing.T) {
+	for name := range token.Builtins {
+		if _, ok := builtins[name]; !ok {
+			t.Errorf("builtin %s has no function", name)
+		}
+	}
+	for name := range builtins {
+		if !token.Builtins[name] {
+			t.Errorf("function %s is not a builtin name", name)
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*meta.Array)
+	if !ok {
+		t.Fatalf("target is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntMeta(t, result.Elements[0], 1)
+	testIntMeta(t, result.Elements[1], 4)
+	testIntMeta(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][2]", 3},
+		{"var i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"var a = [1, 2, 3]; a[2];", 3},
+		{"var a = [1, 2, 3]; a[0] + a[1] + a[2];", 6},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"var a = [1, 2, 3]; a[1] = 5; a[1]", 5},
+		{"var a = [[1], [2]]; a[1][0] = 7; a[1][0]", 7},
+		{"var a = [1, 2, 3]; a[-1] = a[0] + 9; a[2]", 10},
+		{"len([1, 2, 3])", 3},
+		{"len([])", 0},
+		{"[1, 2, 3][3]", "index out of range [3] with length 3"},
+		{"[1, 2, 3][-4]", "index out of range [-4] with length 3"},
+		{`[1]["a"]`, "array index must be INT, got STRING"},
+		{"var a = []; a[0] = 1", "index out of range [0] with length 0"},
+		{"1[0]", "index operator not supported: INT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntMeta(t, evaluated, int64(expected))
+		case string:
+			testErrorMeta(t, evaluated, expected)
+		}
+	}
+}
+
+func TestArraySlicesAndOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []interface{}{2, 3}},
+		{"[1, 2, 3, 4][:2]", []interface{}{1, 2}},
+		{"[1, 2, 3, 4][2:]", []interface{}{3, 4}},
+		{"[1, 2, 3, 4][:]", []interface{}{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][:-1]", []interface{}{1, 2, 3}},
+		{"[1, 2, 3, 4][-2:]", []interface{}{3, 4}},
+		{"[1, 2][1:1]", []interface{}{}},
+		{"var a = [1, 2]; var b = a[:]; b[0] = 9; a", []interface{}{1, 2}},
+		{"[1, 2] + [3]", []interface{}{1, 2, 3}},
+		{`["a"] + []`, []interface{}{"a"}},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] == [1, 3]", false},
+		{"[1, 2] != [1]", true},
+		{`[1] == ["1"]`, false},
+		{"var a = [1]; a[0] = a; a == a", true},
+		{"var a = [1]; a[0] = a; var b = [1]; b[0] = b; [a, 1] == [b, 1]", true},
+		{"var a = [1]; a[0] = a; var b = [2]; b[0] = b; [a, 1] == [b, 2]", false},
+		{"[1, 2, 3][2:1]", errorMeta(meta.IndexError, "slice bounds out of range [2:1] with length 3")},
+		{"[1, 2, 3][0:4]", errorMeta(meta.IndexError, "slice bounds out of range [0:4] with length 3")},
+		{"[1] - [1]", errorMeta(meta.TypeError, "unknown operator: ARRAY - ARRAY")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+
+	if echo := testEval("var a = [1, [2]]; a[1][0] = a; a").Echo(); echo != "[1, [[...]]]" {
+		t.Errorf("wrong echo. expected=%q, got=%q", "[1, [[...]]]", echo)
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `var two = "two"
+{
+	"one": 10 - 9,
+	two: 1 + 1,
+	"thr" + "ee": 6 / 2,
+	4: 4,
+	true: 5,
+	false: 6
+}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*meta.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		key   meta.Hashable
+		value int64
+	}{
+		{&meta.String{Value: "one"}, 1},
+		{&meta.String{Value: "two"}, 2},
+		{&meta.String{Value: "three"}, 3},
+		{&meta.Int{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+
+	pairs := result.Ordered()
+	if len(pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(pairs))
+	}
+
+	for i, want := range expected {
+		if pairs[i].Key.(meta.Hashable).HashKey() != want.key.HashKey() {
+			t.Errorf("pairs[%d] has wrong key. got=%s", i, pairs[i].Key.Echo())
+		}
+		testIntMeta(t, pairs[i].Value, want.value)
+	}
+}
+
+func TestHashOperations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`var key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`var h = {"a": 1}; h["b"] = 2; h["a"] = 3; [keys(h), values(h)]`, []interface{}{[]interface{}{"a", "b"}, []interface{}{3, 2}}},
+		{`var h = {"a": 1, "b": 2, "c": 3}; delete(h, "b"); keys(h)`, []interface{}{"a", "c"}},
+		{`var h = {"a": 1}; delete(h, "zz"); len(h)`, 1},
+		{`var h = {"z": 1, "a": 2}; h["m"] = 3; keys(h)`, []interface{}{"z", "a", "m"}},
+		{`values({"z": 1, "a": [2]})`, []interface{}{1, []interface{}{2}}},
+		{`"a" in {"a": nil}`, true},
+		{`"b" in {"a": 1}`, false},
+		{`2 in [1, 2, 3]`, true},
+		{`[1] in [[1], [2]]`, true},
+		{`4 in [1, 2, 3]`, false},
+		{`{"a": 1, 2: "b"} == {2: "b", "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": [1]} != {"a": [1]}`, false},
+		{`var h = {}; h["self"] = h; h == h`, true},
+		{`var h = {}; h["self"] = h; var g = {}; g["self"] = g; h == g`, true},
+		{`var h = {"n": 1}; h["self"] = h; var g = {"n": 2}; g["self"] = g; h == g`, false},
+		{`len({1: 1, 2: 2})`, 2},
+		{`values({"name": "dao"})`, []interface{}{"dao"}},
+		{`{[1]: 2}`, errorMeta(meta.TypeError, "unusable as hash key: ARRAY")},
+		{`{"a": 1}[func() {}]`, errorMeta(meta.TypeError, "unusable as hash key: FUNC")},
+		{`var h = {}; h[[1]] = 1`, errorMeta(meta.TypeError, "unusable as hash key: ARRAY")},
+		{`[1] in {}`, errorMeta(meta.TypeError, "unusable as hash key: ARRAY")},
+		{`1 in 1`, errorMeta(meta.TypeError, "unknown operator: INT in INT")},
+		{`delete([1], 0)`, errorMeta(meta.TypeError, "first argument to `delete` must be HASH, got ARRAY")},
+		{`keys([1])`, errorMeta(meta.TypeError, "argument to `keys` must be HASH, got ARRAY")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+
+	expected := `{"a": [1], "self": {...}}`
+	if echo := testEval(`var h = {"a": [1]}; h["self"] = h; h`).Echo(); echo != expected {
+		t.Errorf("wrong echo. expected=%q, got=%q", expected, echo)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type P struct { x int; y int }; var p = P{x: 1, y: 2}; [p.x, p.y]`, []interface{}{1, 2}},
+		{`type P struct { x int; f float; s string; b bool; a array; n P }; var p = P{}; [p.x, p.f, p.s, p.b, p.a, p.n]`, []interface{}{0, 0.0, "", false, nil, nil}},
+		{`type P struct { x int }; var p = P{x: 1}; p.x`, 1},
+		{`type P struct { x int }; var p = P{}; p.x = 5; p.x += 2; p.x++; p.x`, 8},
+		{`type P struct { f float }; var p = P{f: 1}; p.f`, 1.0},
+		{`type P struct { x int }; var p = P{}; var q = p; q.x = 3; p.x`, 3},
+		{`type P struct { x int }; func set(p P) { p.x = 9 }; var p = P{}; set(p); p.x`, 9},
+		{`type P struct { x int }; P{x: 1} == P{x: 1}`, true},
+		{`type P struct { x int }; P{x: 1} != P{x: 2}`, true},
+		{`type N struct { v int; next N }; var n = N{v: 1, next: N{v: 2}}; n.next.v`, 2},
+		{`type N struct { v int; next N }; var n = N{v: 1}; n.next = n; n == n`, true},
+		{`type N struct { v int; next N }; var n = N{v: 1}; n.next = n; var m = N{v: 1}; m.next = m; n == m`, true},
+		{`type N struct { v int; next N }; var n = N{v: 1}; n.next = n; var m = N{v: 2}; m.next = m; n == m`, false},
+		{`type P struct { x int }; [P{x: 1}][0].x`, 1},
+		{`type P struct { x int }; P{x: "a"}`, errorMeta(meta.TypeError, "field x of P must be int, got STRING")},
+		{`type P struct { x int }; var p = P{}; p.x = 1.5`, errorMeta(meta.TypeError, "field x of P must be int, got FLOAT")},
+		{`type P struct { n P }; type Q struct {}; P{n: Q{}}`, errorMeta(meta.TypeError, "field n of P must be P, got Q")},
+		{`type P struct { x int }; P{y: 1}`, errorMeta(meta.NameError, "unknown field y in struct literal of type P")},
+		{`type P struct { x int }; P{}.y`, errorMeta(meta.NameError, "P has no field or method y")},
+		{`type P struct { x int }; var p = P{}; p.y = 1`, errorMeta(meta.NameError, "P has no field y")},
+		{`Q{}`, errorMeta(meta.NameError, "undefined type: Q")},
+		{`var Q = 1; Q{}`, errorMeta(meta.TypeError, "Q is not a struct type")},
+		{`1.x`, errorMeta(meta.TypeError, "selector not supported: INT")},
+		{`var a = 1; a.x = 2`, errorMeta(meta.TypeError, "field assignment not supported: INT")},
+		{`type P struct { x int }; func f(p P) { p }; f(1)`, errorMeta(meta.TypeError, "argument p of f must be P, got INT")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+
+	input := `type P struct { x int; f float; s string; b bool; a array; n P }; P{}`
+	expected := `P{x: 0, f: 0.0, s: "", b: false, a: nil, n: nil}`
+	if echo := testEval(input).Echo(); echo != expected {
+		t.Errorf("wrong echo. expected=%q, got=%q", expected, echo)
+	}
+
+	input = `type N struct { v int; next N }; var n = N{v: 1}; n.next = n; n`
+	expected = `N{v: 1, next: N{...}}`
+	if echo := testEval(input).Echo(); echo != expected {
+		t.Errorf("wrong echo. expected=%q, got=%q", expected, echo)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type P struct { x int; y int }; func (p P) norm() int { p.x * p.x + p.y * p.y }; P{x: 3, y: 4}.norm()`, 25},
+		{`type P struct { x int }; func (p P) add(n int) { p.x += n; p }; var p = P{}; p.add(2).add(3); p.x`, 5},
+		{`type P struct { x int }; func (p P) get() { p.x }; var g = P{x: 7}.get; g()`, 7},
+		{`type P struct { x int }; func show(p P) { p.str() }; func (p P) str() { "P" + "!" }; show(P{})`, "P!"},
+		{`type P struct { x int }; var n = 0; func (p P) inc() { n = n + 1 }; P{}.inc(); n`, 1},
+		{`func (p P) get() { p.x }; type P struct { x int }; P{x: 4}.get()`, 4},
+		{`var v = P{x: 5}.get(); type P struct { x int }; func (p P) get() { p.x }; v`, 5},
+		{`func f() { var e = A; enum E { A, B }; func (p P) is(v E) { v == e }; type P struct {}; P{}.is(A) }; f()`, true},
+		{`var h = half(4); func half(n int) { n / 2 }; h`, 2},
+		{`func (p Q) f() {}`, errorMeta(meta.NameError, "undefined type: Q")},
+		{`type P struct { x int }; func (p P) x() {}`, errorMeta(meta.TypeError, "field and method with the same name x")},
+		{`type P struct {}; func (p P) f(n int) {}; P{}.f()`, errorMeta(meta.ArityError, "wrong number of arguments in call to P.f: got 0, want 1")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	shapes := `type Shape interface { area() int }
+type Rect struct { w int; h int }
+type Square struct { s int }
+func (r Rect) area() int { r.w * r.h }
+func (s Square) area() { s.s * s.s }
+`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`var s Shape = Rect{w: 2, h: 3}; s.area()`, 6},
+		{`var shapes = [Rect{w: 1, h: 2}, Square{s: 3}]; var sum = 0; for var i = 0; i++; i < 2 { var s Shape = shapes[i]; sum += s.area() }; sum`, 11},
+		{`func area(s Shape) int { s.area() }; area(Square{s: 2})`, 4},
+		{`var s Shape = nil; s`, nil},
+		{`var s Shape = Square{s: 2}; s.(Square).s`, 2},
+		{`var s Shape = Square{s: 2}; s.(Shape).area()`, 4},
+		{`var x = 1.5; x.(float)`, 1.5},
+		{`type T struct {}; var t Shape = T{}`, errorMeta(meta.TypeError, "var t must be Shape, got T")},
+		{`func area(s Shape) int { s.area() }; area(1)`, errorMeta(meta.TypeError, "argument s of area must be Shape, got INT")},
+		{`var s Shape = Square{s: 2}; s.(Rect)`, errorMeta(meta.TypeError, "type assertion failed: Square is not Rect")},
+		{`1.(float)`, errorMeta(meta.TypeError, "type assertion failed: INT is not float")},
+		{`nil.(Shape)`, errorMeta(meta.TypeError, "type assertion failed: NIL is not Shape")},
+		{`1.(Circle)`, errorMeta(meta.NameError, "undefined type: Circle")},
+		{`type B interface { area(n int) int }; var b B = Rect{}`, errorMeta(meta.TypeError, "var b must be B, got Rect")},
+		{`var f float = 1; f`, 1.0},
+		{`var n int = "a"`, errorMeta(meta.TypeError, "var n must be int, got STRING")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(shapes+tt.input), tt.expected)
+	}
+}
+
+func TestEnumsAndMatch(t *testing.T) {
+	enums := `enum Result { Ok(v), Err(msg) }
+enum Color { Red, Green, Blue }
+`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`Err("x") == Err("x")`, true},
+		{`Ok(1) == Err(1)`, false},
+		{`Red == Red`, true},
+		{`match Ok(2) { Ok(v) => v * 10, Err(e) => e }`, 20},
+		{`match Err("no") { Ok(v) => v, Err(e) => { "error: " + e } }`, "error: no"},
+		{`match Blue { Red => 1, Green => 2, _ => 3 }`, 3},
+		{`match Green { Red => 1 }`, nil},
+		{`match Ok(Ok(1)) { Ok(Err(x)) => x, Ok(Ok(x)) => x + 1 }`, 2},
+		{`match 3 { 1 => "one", 3 => "three" }`, "three"},
+		{`match -1 { -1 => "minus" }`, "minus"},
+		{`match "a" { "b" => 1, other => other }`, "a"},
+		{`match [1, 2, 3] { [] => 0, [x] => x, [x, ..rest] => rest }`, []interface{}{2, 3}},
+		{`match [1, 2] { [1, ..] => "starts with 1" }`, "starts with 1"},
+		{`match [1, 2] { [x, y, ..] => x + y }`, 3},
+		{`match [1] { [x, y] => 1, _ => 0 }`, 0},
+		{`match Ok(1) { Ok(v) => v }; v`, errorMeta(meta.NameError, "identifier not found: v")},
+		{`var v = 5; match Ok(1) { Ok(v) => v }; v`, 5},
+		{`var v = 5; var w = match Ok(1) { Ok(v) => v }; v + w`, 6},
+		{`func f(c Color) string { match c { Red => "r", _ => "?" } }; f(Red) + f(Blue)`, "r?"},
+		{`var r Result = Ok(1); r == Ok(1)`, true},
+		{`var r Result = 1`, errorMeta(meta.TypeError, "var r must be Result, got INT")},
+		{`Ok(1, 2)`, errorMeta(meta.ArityError, "wrong number of arguments in call to Ok: got 2, want 1")},
+		{`match Ok(1) { Ok => 1 }`, errorMeta(meta.ArityError, "wrong number of values in pattern Ok: got 0, want 1")},
+		{`match Ok(1) { Ok(a, b) => 1 }`, errorMeta(meta.ArityError, "wrong number of values in pattern Ok: got 2, want 1")},
+		{`match Red { Red(x) => 1 }`, errorMeta(meta.NameError, "Red is not a variant with values")},
+		{`match x { _ => 1 }`, errorMeta(meta.NameError, "identifier not found: x")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(enums+tt.input), tt.expected)
+	}
+
+	for input, expected := range map[string]string{`Ok(1)`: "Ok(1)", `Red`: "Red"} {
+		if echo := testEval(enums + input).Echo(); echo != expected {
+			t.Errorf("wrong echo for %q. expected=%q, got=%q", input, expected, echo)
+		}
+	}
+}
+
+func TestFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"2.0", 2.0},
+		{"-2.5", -2.5},
+		{"1e-3", 0.001},
+		{"1e21", 1e21},
+		{"0.1 + 0.2", 0.30000000000000004},
+		{"1.5 * 2", 3.0},
+		{"3 / 2.0", 1.5},
+		{"3 / 2", 1},
+		{"7.5 % 2", 1.5},
+		{"1 + 2.5 - 0.5", 3.0},
+		{"1.5 < 2", true},
+		{"2 > 2.5", false},
+		{"1 == 1.0", true},
+		{"1.5 != 1.5", false},
+		{"[1, 2] == [1.0, 2]", true},
+		{"var ratio = 3 * 100 / 4.0; ratio", 75.0},
+		{"int(2.7)", 2},
+		{"int(-2.7)", -2},
+		{`int("42")`, 42},
+		{"int(true)", 1},
+		{"float(3)", 3.0},
+		{`float("1e2")`, 100.0},
+		{"1.5 / 0", errorMeta(meta.DivisionByZero, "float divide by zero")},
+		{"1 % 0.0", errorMeta(meta.DivisionByZero, "float divide by zero")},
+		{`int("4x")`, errorMeta(meta.ValueError, `cannot convert "4x" to int`)},
+		{`float("x")`, errorMeta(meta.ValueError, `cannot convert "x" to float`)},
+		{"int(1e20)", errorMeta(meta.ValueError, "cannot convert 1e+20 to int")},
+		{"float([1])", errorMeta(meta.TypeError, "argument to `float` not supported, got ARRAY")},
+		{`"a" + 1.5`, errorMeta(meta.TypeError, "type mismatch: STRING + FLOAT")},
+	}
+
+	for _, tt := range tests {
+		testMeta(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFloatEcho(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2.0", "2.0"},
+		{"1.5 * 2", "3.0"},
+		{"1e21", "1e+21"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+	}
+
+	for _, tt := range tests {
+		if echo := testEval(tt.input).Echo(); echo != tt.expected {
+			t.Errorf("wrong echo for %q. expected=%q, got=%q", tt.input, tt.expected, echo)
+		}
+	}
+}
+
+func testErrorMeta(t *testing.T, m meta.Meta, expected string) bool {
+	err, ok := m.(*meta.Error)
+	if !ok {
+		t.Errorf("target is not Error. got=%T (%+v)", m, m)
+		return false
+	}
+
+	if err.Msg != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, err.Msg)
+		return false
+	}
+
+	return true
+}
+
+// errorMeta is the runtime error of kind with msg that a test expects.
+func errorMeta(kind meta.ErrorKind, msg string) *meta.Error {
+	return &meta.Error{Kind: kind, Msg: msg}
+}
+
+// testMeta checks m against the expected value of a table test: an int, a
+// float64, a bool, a string, nil for NIL, the elements of an array or a
+// runtime error.
+func testMeta(t *testing.T, m meta.Meta, expected interface{}) bool {
+	switch expected := expected.(type) {
+	case int:
+		return testIntMeta(t, m, int64(expected))
+	case float64:
+		return testFloatMeta(t, m, expected)
+	case bool:
+		return testBoolMeta(t, m, expected)
+	case string:
+		return testStrMeta(t, m, expected)
+	case []interface{}:
+		return testArrayMeta(t, m, expected)
+	case *meta.Error:
+		if !testErrorMeta(t, m, expected.Msg) {
+			return false
+		}
+		if kind := m.(*meta.Error).Kind; kind != expected.Kind {
+			t.Errorf("wrong error kind. expected=%s, got=%s", expected.Kind, kind)
+			return false
+		}
+		return true
+	case nil:
+		return testNil(t, m)
+	}
+	t.Fatalf("unsupported expected value %T (%+v)", expected, expected)
+	return false
+}
+
+func testArrayMeta(t *testing.T, m meta.Meta, expected []interface{}) bool {
+	array, ok := m.(*meta.Array)
+	if !ok {
+		t.Errorf("target is not Array. got=%T (%+v)", m, m)
+		return false
+	}
+
+	if len(array.Elements) != len(expected) {
+		t.Errorf("array has wrong num of elements. got=%d, want=%d", len(array.Elements), len(expected))
+		return false
+	}
+	for i, el := range expected {
+		if !testMeta(t, array.Elements[i], el) {
+			return false
+		}
+	}
+	return true
+}
+
 func testNil(t *testing.T, m meta.Meta) bool {
 	if m != NIL {
 		t.Errorf("target is not NULL. got=%T (%+v)", m, m)
@@ -478,6 +1412,7 @@ func testEval(input string) meta.Meta {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.Parse()
+	resolver.Resolve(program)
 	e := meta.NewEnv()
 
 	return Eval(program, e)
@@ -498,6 +1433,21 @@ func testIntMeta(t *testing.T, m meta.Meta, expected int64) bool {
 	return true
 }
 
+func testFloatMeta(t *testing.T, m meta.Meta, expected float64) bool {
+	res, ok := m.(*meta.Float)
+	if !ok {
+		t.Errorf("target is not Float. got %T (%+v)", m, m)
+		return false
+	}
+
+	if res.Value != expected {
+		t.Errorf("target got wrong value. got %g. want %g", res.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testBoolMeta(t *testing.T, m meta.Meta, expected bool) bool {
 	res, ok := m.(*meta.Bool)
 	if !ok {
@@ -1,43 +1,134 @@
 package lexer
 
-import "dao/token"
+import (
+	"dao/token"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 type Lexer struct {
-	input   string
-	pos     int
-	nextPos int
-	ch      byte
+	filename string
+	input    string
+	pos      int
+	nextPos  int
+	ch       byte
+	line     int // line of ch
+	col      int // column of ch
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile returns a lexer whose token positions carry filename.
+func NewFile(filename, input string) *Lexer {
+	return NewAt(filename, input, 1)
+}
+
+// NewAt returns a lexer whose input starts at line of the source, as the
+// inputs of a REPL session do.
+func NewAt(filename, input string, line int) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: line}
 	l.eat()
 	return l
 }
 
+// Next returns the next token, the comments before it are kept in
+// tok.Comments.
 func (l *Lexer) Next() token.Token {
+	var comments []token.Token
+	for {
+		l.eatBlank()
+		if l.ch != '/' || l.peak() != '/' && l.peak() != '*' {
+			break
+		}
+
+		comment := l.eatComment()
+		if comment.Type == token.ILLEGAL {
+			comment.Comments = comments
+			return comment
+		}
+		comments = append(comments, comment)
+	}
+
+	pos := l.position()
+	tok := l.scan()
+	if !tok.Pos.IsValid() {
+		tok.Pos = pos
+		tok.End = l.position()
+	}
+	if tok.Type == token.EOF {
+		tok.End = pos
+	}
+	tok.Comments = comments
+
+	return tok
+}
+
+// eatComment reads a // line comment up to the end of line, or a /* block
+// comment */ which may be nested. An unterminated block comment gives an
+// ILLEGAL token spanning its opening /*.
+func (l *Lexer) eatComment() token.Token {
+	pos := l.position()
+	l.eat()
+	if l.ch == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.eat()
+		}
+		return token.Token{Type: token.COMMENT, Literal: l.input[pos.Offset:l.pos], Pos: pos, End: l.position()}
+	}
+
+	l.eat()
+	for depth := 1; depth > 0; {
+		switch {
+		case l.ch == 0:
+			return l.illegal(pos, 2, "unterminated block comment")
+		case l.ch == '/' && l.peak() == '*':
+			depth++
+			l.eat()
+		case l.ch == '*' && l.peak() == '/':
+			depth--
+			l.eat()
+		}
+		l.eat()
+	}
+	return token.Token{Type: token.COMMENT, Literal: l.input[pos.Offset:l.pos], Pos: pos, End: l.position()}
+}
+
+func (l *Lexer) position() token.Position {
+	return token.Position{Filename: l.filename, Offset: l.pos, Line: l.line, Column: l.col}
+}
+
+func (l *Lexer) scan() token.Token {
 	var tok token.Token
-	l.eatBlank()
 
 	switch l.ch {
 	case '=':
-		if l.peak() == '=' {
-			ch := l.ch
-			l.eat()
-			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+		if l.peak() == '>' {
+			tok = l.either('>', token.ARROW, token.ASSIGN)
 		} else {
-			tok = token.New(token.ASSIGN, l.ch)
+			tok = l.either('=', token.EQ, token.ASSIGN)
 		}
 	case '+':
-		tok = token.New(token.PLUS, l.ch)
+		if l.peak() == '+' {
+			tok = l.either('+', token.INC, token.PLUS)
+		} else {
+			tok = l.either('=', token.PLUS_ASSIGN, token.PLUS)
+		}
 	case '-':
-		tok = token.New(token.MINUS, l.ch)
+		if l.peak() == '-' {
+			tok = l.either('-', token.DEC, token.MINUS)
+		} else {
+			tok = l.either('=', token.MINUS_ASSIGN, token.MINUS)
+		}
 	case '*':
-		tok = token.New(token.ASTERISK, l.ch)
+		tok = l.either('=', token.ASTERISK_ASSIGN, token.ASTERISK)
 	case '/':
-		tok = token.New(token.SLASH, l.ch)
+		tok = l.either('=', token.SLASH_ASSIGN, token.SLASH)
 	case '%':
-		tok = token.New(token.MOD, l.ch)
+		tok = l.either('=', token.MOD_ASSIGN, token.MOD)
 	case '!':
 		if l.peak() == '=' {
 			ch := l.ch
@@ -47,9 +138,29 @@ func (l *Lexer) Next() token.Token {
 			tok = token.New(token.BANG, l.ch)
 		}
 	case '<':
-		tok = token.New(token.LT, l.ch)
+		if l.peak() == '<' {
+			tok = l.either('<', token.SHL, token.LT)
+		} else {
+			tok = l.either('=', token.LE, token.LT)
+		}
 	case '>':
-		tok = token.New(token.GT, l.ch)
+		if l.peak() == '>' {
+			tok = l.either('>', token.SHR, token.GT)
+		} else {
+			tok = l.either('=', token.GE, token.GT)
+		}
+	case '&':
+		if l.peak() == '^' {
+			tok = l.either('^', token.AND_NOT, token.AMP)
+		} else {
+			tok = l.either('&', token.AND, token.AMP)
+		}
+	case '|':
+		tok = l.either('|', token.OR, token.PIPE)
+	case '^':
+		tok = token.New(token.CARET, l.ch)
+	case '~':
+		tok = token.New(token.TILDE, l.ch)
 	case '(':
 		tok = token.New(token.LPAREN, l.ch)
 	case ')':
@@ -66,9 +177,14 @@ func (l *Lexer) Next() token.Token {
 		tok = token.New(token.COMMA, l.ch)
 	case ';':
 		tok = token.New(token.SEMICOLON, l.ch)
+	case ':':
+		tok = token.New(token.COLON, l.ch)
+	case '.':
+		tok = token.New(token.DOT, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		return l.readString()
+	case '`':
+		return l.readRawString()
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -78,11 +194,10 @@ func (l *Lexer) Next() token.Token {
 			tok.Type = token.GetTokenType(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.eatNumber()
+			tok.Literal, tok.Type = l.eatNumber()
 			return tok
 		} else {
-			tok = token.New(token.ILLEGAL, l.ch)
+			tok = l.illegalChar()
 		}
 	}
 
@@ -90,7 +205,24 @@ func (l *Lexer) Next() token.Token {
 	return tok
 }
 
+// either returns a two-character token tt when ch is followed by next,
+// otherwise the one-character token single.
+func (l *Lexer) either(next byte, tt, single token.TokenType) token.Token {
+	if l.peak() == next {
+		ch := l.ch
+		l.eat()
+		return token.Token{Type: tt, Literal: string(ch) + string(l.ch)}
+	}
+	return token.New(single, l.ch)
+}
+
 func (l *Lexer) eat() {
+	if l.ch == '\n' {
+		l.line++
+		l.col = 0
+	}
+	l.col++
+
 	if l.nextPos >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -108,6 +240,14 @@ func (l *Lexer) peak() byte {
 	}
 }
 
+// peakAt looks n bytes ahead of ch, peakAt(1) is peak().
+func (l *Lexer) peakAt(n int) byte {
+	if l.pos+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.pos+n]
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
@@ -116,6 +256,10 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHex(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func isBlank(ch byte) bool {
 	return ch == ' ' || ch == '\n' || ch == '\t' || ch == '\r'
 }
@@ -134,22 +278,173 @@ func (l *Lexer) eatBlank() {
 	}
 }
 
-func (l *Lexer) eatNumber() string {
+// eatNumber reads an integer, or a float when there is a fraction or an
+// exponent: 1, 1.5, 1e-3, 2.5E+10. Integers may have a 0x, 0o or 0b prefix,
+// and digits may be separated by _: 1_000_000. The digits are checked by
+// the parser.
+func (l *Lexer) eatNumber() (string, token.TokenType) {
 	pos := l.pos
-	for isDigit((l.ch)) {
+	tt := token.TokenType(token.INT)
+
+	if l.ch == '0' && isBasePrefix(l.peak()) {
+		l.eat()
 		l.eat()
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.eat()
+		}
+		return l.input[pos:l.pos], tt
 	}
-	return l.input[pos:l.pos]
+
+	l.eatDigits()
+	if l.ch == '.' && isDigit(l.peak()) {
+		tt = token.FLOAT
+		l.eat()
+		l.eatDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peak()
+		if (next == '+' || next == '-') && isDigit(l.peakAt(2)) {
+			tt = token.FLOAT
+			l.eat()
+			l.eat()
+			l.eatDigits()
+		} else if isDigit(next) {
+			tt = token.FLOAT
+			l.eat()
+			l.eatDigits()
+		}
+	}
+
+	return l.input[pos:l.pos], tt
 }
 
-func (l *Lexer) readString() string {
-	pos := l.pos + 1
-	for {
+func (l *Lexer) eatDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
 		l.eat()
-		if l.ch == '"' || l.ch == 0 {
-			break
+	}
+}
+
+func isBasePrefix(ch byte) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+// readString reads a "quoted string" and decodes its escapes:
+// \n \t \r \0 \" \\ and \u{1F600}. The string must end on the line it
+// starts, otherwise the ILLEGAL token points at the opening quote.
+func (l *Lexer) readString() token.Token {
+	start := l.position()
+	var sb strings.Builder
+	var bad *token.Token
+
+	l.eat()
+	for l.ch != '"' {
+		switch l.ch {
+		case 0, '\n':
+			return l.illegal(start, 1, "unterminated string literal")
+		case '\\':
+			pos := l.position()
+			s, msg := l.eatEscape()
+			if msg != "" && bad == nil {
+				tok := l.illegal(pos, l.pos-pos.Offset, msg)
+				bad = &tok
+			}
+			sb.WriteString(s)
+		default:
+			sb.WriteByte(l.ch)
+			l.eat()
 		}
 	}
+	l.eat()
 
-	return l.input[pos:l.pos]
+	if bad != nil {
+		return *bad
+	}
+	return token.Token{Type: token.STRING, Literal: sb.String(), Pos: start, End: l.position()}
+}
+
+// eatEscape reads one escape sequence starting at the backslash, msg is
+// not empty when the sequence is invalid.
+func (l *Lexer) eatEscape() (s string, msg string) {
+	l.eat()
+	ch := l.ch
+	switch ch {
+	case 'n':
+		s = "\n"
+	case 't':
+		s = "\t"
+	case 'r':
+		s = "\r"
+	case '0':
+		s = "\x00"
+	case '"', '\\':
+		s = string(ch)
+	case 'u':
+		return l.eatUnicode()
+	case 0, '\n':
+		return "", "unterminated escape sequence"
+	default:
+		l.eat()
+		return "", fmt.Sprintf("unknown escape sequence \\%c", ch)
+	}
+	l.eat()
+	return s, ""
+}
+
+// eatUnicode reads the {hex} part of \u{hex}.
+func (l *Lexer) eatUnicode() (string, string) {
+	l.eat()
+	if l.ch != '{' {
+		return "", "expect { after \\u"
+	}
+	l.eat()
+
+	pos := l.pos
+	for isHex(l.ch) {
+		l.eat()
+	}
+	digits := l.input[pos:l.pos]
+	if l.ch != '}' {
+		return "", "expect } to close \\u{"
+	}
+	l.eat()
+
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+		return "", fmt.Sprintf("invalid unicode code point \\u{%s}", digits)
+	}
+	return string(rune(code)), ""
+}
+
+// readRawString reads a `raw string`, it has no escapes and may span lines.
+func (l *Lexer) readRawString() token.Token {
+	start := l.position()
+
+	l.eat()
+	pos := l.pos
+	for l.ch != '`' {
+		if l.ch == 0 {
+			return l.illegal(start, 1, "unterminated raw string literal")
+		}
+		l.eat()
+	}
+	lit := strings.ReplaceAll(l.input[pos:l.pos], "\r", "")
+	l.eat()
+
+	return token.Token{Type: token.STRING, Literal: lit, Pos: start, End: l.position()}
+}
+
+func (l *Lexer) illegalChar() token.Token {
+	return token.Token{Type: token.ILLEGAL, Literal: fmt.Sprintf("illegal character %q", l.ch)}
+}
+
+// illegal returns an ILLEGAL token of width bytes at pos.
+func (l *Lexer) illegal(pos token.Position, width int, msg string) token.Token {
+	end := pos
+	end.Offset += width
+	end.Column += width
+	return token.Token{Type: token.ILLEGAL, Literal: msg, Pos: pos, End: end}
 }
@@ -15,7 +15,7 @@ func TestNextToken(t *testing.T) {
 	
 	var result = add(five, ten);
 
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if 5 > 10 {
@@ -35,6 +35,11 @@ func TestNextToken(t *testing.T) {
 	%
 	break
 	for
+	continue outer:
+	"a" in h
+	a <= b >= c && d || e
+	i += 1; i++ -= *= /= %= -- - +
+	& | ^ &^ << >> ~ < >
 	 `
 
 	tests := []struct {
@@ -142,10 +147,47 @@ func TestNextToken(t *testing.T) {
 		{token.MOD, "%"},
 		{token.BREAK, "break"},
 		{token.FOR, "for"},
+		{token.CONTINUE, "continue"},
+		{token.ID, "outer"},
+		{token.COLON, ":"},
+		{token.STRING, "a"},
+		{token.IN, "in"},
+		{token.ID, "h"},
+		{token.ID, "a"},
+		{token.LE, "<="},
+		{token.ID, "b"},
+		{token.GE, ">="},
+		{token.ID, "c"},
+		{token.AND, "&&"},
+		{token.ID, "d"},
+		{token.OR, "||"},
+		{token.ID, "e"},
+		{token.ID, "i"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.ID, "i"},
+		{token.INC, "++"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.MOD_ASSIGN, "%="},
+		{token.DEC, "--"},
+		{token.MINUS, "-"},
+		{token.PLUS, "+"},
+		{token.AMP, "&"},
+		{token.PIPE, "|"},
+		{token.CARET, "^"},
+		{token.AND_NOT, "&^"},
+		{token.SHL, "<<"},
+		{token.SHR, ">>"},
+		{token.TILDE, "~"},
+		{token.LT, "<"},
+		{token.GT, ">"},
 
 		{token.EOF, ""},
 	}
-	// !-/*5; 5 < 10 > 5;
+	// !-/ *5; 5 < 10 > 5;
 
 	l := New(input)
 	for i, tt := range tests {
@@ -159,3 +201,179 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"12", []token.Token{{Type: token.INT, Literal: "12"}}},
+		{"1.5", []token.Token{{Type: token.FLOAT, Literal: "1.5"}}},
+		{"1e-3", []token.Token{{Type: token.FLOAT, Literal: "1e-3"}}},
+		{"2.5E+10", []token.Token{{Type: token.FLOAT, Literal: "2.5E+10"}}},
+		{"3e8", []token.Token{{Type: token.FLOAT, Literal: "3e8"}}},
+		{"1.", []token.Token{{Type: token.INT, Literal: "1"}, {Type: token.DOT, Literal: "."}}},
+		{"2e", []token.Token{{Type: token.INT, Literal: "2"}, {Type: token.ID, Literal: "e"}}},
+		{"2e+", []token.Token{{Type: token.INT, Literal: "2"}, {Type: token.ID, Literal: "e"}, {Type: token.PLUS, Literal: "+"}}},
+		{"0xFF_ff", []token.Token{{Type: token.INT, Literal: "0xFF_ff"}}},
+		{"0o17 0b1010", []token.Token{{Type: token.INT, Literal: "0o17"}, {Type: token.INT, Literal: "0b1010"}}},
+		{"0b102+1", []token.Token{{Type: token.INT, Literal: "0b102"}, {Type: token.PLUS, Literal: "+"}, {Type: token.INT, Literal: "1"}}},
+		{"1_000_000", []token.Token{{Type: token.INT, Literal: "1_000_000"}}},
+		{"1_000.5e1_0", []token.Token{{Type: token.FLOAT, Literal: "1_000.5e1_0"}}},
+		{"0x", []token.Token{{Type: token.INT, Literal: "0x"}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.Next()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("%q tokens[%d] - expected %s %q, got %s %q", tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+		if tok := l.Next(); tok.Type != token.EOF {
+			t.Errorf("%q - expected EOF, got %s %q", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// header
+var a = 1 // => 1
+/* block /* nested */ still comment */ a / 2
+/**/`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.VAR, "var", []string{"// header"}},
+		{token.ID, "a", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "1", nil},
+		{token.ID, "a", []string{"// => 1", "/* block /* nested */ still comment */"}},
+		{token.SLASH, "/", nil},
+		{token.INT, "2", nil},
+		{token.EOF, "", []string{"/**/"}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.Next()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if len(tok.Comments) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - expected %d comments, got %d", i, len(tt.expectedComments), len(tok.Comments))
+		}
+		for j, c := range tok.Comments {
+			if c.Type != token.COMMENT || c.Literal != tt.expectedComments[j] {
+				t.Errorf("tests[%d] - comment %d expected %q, got %s %q", i, j, tt.expectedComments[j], c.Type, c.Literal)
+			}
+		}
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("a\n  /* /* */ b")
+	l.Next()
+
+	tok := l.Next()
+	if tok.Type != token.ILLEGAL || tok.Literal != "unterminated block comment" {
+		t.Fatalf("expected unterminated comment, got %s %q", tok.Type, tok.Literal)
+	}
+	if tok.Pos.Line != 2 || tok.Pos.Column != 3 || tok.End.Column != 5 {
+		t.Errorf("wrong span, got %s-%s", tok.Pos, tok.End)
+	}
+	if tok := l.Next(); tok.Type != token.EOF {
+		t.Errorf("expected EOF, got %s", tok.Type)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		line, column    int
+		endColumn       int
+	}{
+		{`"a\tb\n"`, token.STRING, "a\tb\n", 1, 1, 9},
+		{`"say \"hi\" \\"`, token.STRING, `say "hi" \`, 1, 1, 16},
+		{`"\u{48}\u{e9}\u{1F600}"`, token.STRING, "Hé😀", 1, 1, 24},
+		{"`raw\\n\nline`", token.STRING, "raw\\n\nline", 1, 1, 6},
+		{"`a\r\nb`", token.STRING, "a\nb", 1, 1, 3},
+		{`  "open`, token.ILLEGAL, "unterminated string literal", 1, 3, 4},
+		{"\"line\nnext\"", token.ILLEGAL, "unterminated string literal", 1, 1, 2},
+		{"x `open", token.ILLEGAL, "unterminated raw string literal", 1, 3, 4},
+		{`"a\qb"`, token.ILLEGAL, `unknown escape sequence \q`, 1, 3, 5},
+		{`"\u{110000}"`, token.ILLEGAL, `invalid unicode code point \u{110000}`, 1, 2, 12},
+		{`"\u41"`, token.ILLEGAL, `expect { after \u`, 1, 2, 4},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.Next()
+		if tok.Type == token.ID {
+			tok = l.Next()
+		}
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q - expected %s %q, got %s %q", tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+			continue
+		}
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column || tok.End.Column != tt.endColumn {
+			t.Errorf("%q - expected span %d:%d-%d, got %s-%s", tt.input, tt.line, tt.column, tt.endColumn, tok.Pos, tok.End)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "var x = 10\n  x + \"ab\"\n"
+
+	tests := []struct {
+		expectedType token.TokenType
+		line, column int
+		offset       int
+		endColumn    int
+	}{
+		{token.VAR, 1, 1, 0, 4},
+		{token.ID, 1, 5, 4, 6},
+		{token.ASSIGN, 1, 7, 6, 8},
+		{token.INT, 1, 9, 8, 11},
+		{token.ID, 2, 3, 13, 4},
+		{token.PLUS, 2, 5, 15, 6},
+		{token.STRING, 2, 7, 17, 11},
+		{token.EOF, 3, 1, 22, 1},
+	}
+
+	l := NewFile("test.dao", input)
+	for i, tt := range tests {
+		tok := l.Next()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype goes wrong, expected %q but got %q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.Filename != "test.dao" {
+			t.Fatalf("tests[%d] - filename goes wrong, got %q", i, tok.Pos.Filename)
+		}
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Fatalf("tests[%d] - position goes wrong, expected %d:%d but got %d:%d", i, tt.line, tt.column, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.Offset != tt.offset {
+			t.Fatalf("tests[%d] - offset goes wrong, expected %d but got %d", i, tt.offset, tok.Pos.Offset)
+		}
+		if tok.End.Column != tt.endColumn {
+			t.Fatalf("tests[%d] - end column goes wrong, expected %d but got %d", i, tt.endColumn, tok.End.Column)
+		}
+	}
+}
+
+func TestNewAt(t *testing.T) {
+	l := NewAt("", "x\n y", 3)
+	for _, want := range []string{"3:1", "4:2"} {
+		tok := l.Next()
+		if tok.Pos.String() != want {
+			t.Errorf("position of %q goes wrong, expected %s but got %s", tok.Literal, want, tok.Pos)
+		}
+	}
+}
@@ -21,8 +21,12 @@ func main() {
 			fmt.Println("v0.0.1")
 		} else if os.Args[1] == "-h" || os.Args[1] == "help" {
 			help()
-		} else {
-			repl.Eat(os.Args[1])
+		} else if !repl.Eat(os.Args[1]) {
+			os.Exit(1)
+		}
+	case cmdLen == 3 && os.Args[1] == "check":
+		if !repl.Check(os.Args[2]) {
+			os.Exit(1)
 		}
 	default:
 		runRepl()
@@ -48,5 +52,6 @@ func help() {
 dao -h:        help list;
 dao:           run the interpreter;
 dao <source file>: eval the source file   
+dao check <source file>: type check the source file
 	`)
 }
@@ -3,19 +3,30 @@ package meta
 import (
 	"bytes"
 	"dao/ast"
+	"dao/diag"
+	"dao/token"
 	"fmt"
+	"hash/fnv"
+	"strconv"
 	"strings"
 )
 
 const (
 	INT          = "INT"
+	FLOAT        = "FLOAT"
 	BOOL         = "BOOL"
 	STRING       = "STRING"
 	NIL          = "NIL"
 	FUNC         = "FUNC"
 	RETURN_VALUE = "RETURN_VALUE"
+	BREAK        = "BREAK"
+	CONTINUE     = "CONTINUE"
 	ERROR        = "ERROR"
 	BUILTIN      = "BUILTIN"
+	ARRAY        = "ARRAY"
+	TUPLE        = "TUPLE"
+	HASH         = "HASH"
+	TYPE         = "TYPE"
 )
 
 type MetaType string
@@ -36,6 +47,23 @@ func (i *Int) Echo() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() MetaType {
+	return FLOAT
+}
+
+// Echo always shows a float as one, 2 echoes "2.0" rather than "2".
+func (f *Float) Echo() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+
 type Bool struct {
 	Value bool
 }
@@ -54,6 +82,308 @@ type String struct {
 func (s *String) Type() MetaType { return STRING }
 func (s *String) Echo() string   { return s.Value }
 
+type Array struct {
+	Elements []Meta
+}
+
+func (a *Array) Type() MetaType { return ARRAY }
+func (a *Array) Echo() string   { return a.echo(map[Meta]bool{}) }
+
+// echo shows an array that contains itself as [...] where it repeats.
+func (a *Array) echo(seen map[Meta]bool) string {
+	if seen[a] {
+		return "[...]"
+	}
+	seen[a] = true
+	defer delete(seen, a)
+
+	elements := []string{}
+	for _, el := range a.Elements {
+		elements = append(elements, inspect(el, seen))
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Tuple holds the values of a function returning several of them, until a
+// var or an assignment unpacks them.
+type Tuple struct {
+	Values []Meta
+}
+
+func (t *Tuple) Type() MetaType { return TUPLE }
+func (t *Tuple) Echo() string   { return t.echo(map[Meta]bool{}) }
+
+func (t *Tuple) echo(seen map[Meta]bool) string {
+	values := []string{}
+	for _, v := range t.Values {
+		values = append(values, inspect(v, seen))
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+// container is a meta holding other metas, which may hold it in turn.
+// seen has the containers being shown around it.
+type container interface {
+	echo(seen map[Meta]bool) string
+}
+
+// Inspect is Echo, but with strings quoted, for showing the elements of
+// containers.
+func Inspect(m Meta) string {
+	return inspect(m, map[Meta]bool{})
+}
+
+func inspect(m Meta, seen map[Meta]bool) string {
+	switch m := m.(type) {
+	case *String:
+		return strconv.Quote(m.Value)
+	case container:
+		return m.echo(seen)
+	}
+	return m.Echo()
+}
+
+// HashKey identifies a hashable meta by value: equal keys of the same type
+// hash to the same HashKey.
+type HashKey struct {
+	Type  MetaType
+	Value uint64
+}
+
+// Hashable metas can be used as the keys of a Hash.
+type Hashable interface {
+	Meta
+	HashKey() HashKey
+}
+
+func (i *Int) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Bool) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Meta
+	Value Meta
+}
+
+// Hash is a map that remembers the order its keys were inserted in.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey // 插入顺序
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Get(key Hashable) (Meta, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Set adds or updates the pair, an updated key keeps its position.
+func (h *Hash) Set(key Hashable, val Meta) {
+	hk := key.HashKey()
+	if _, ok := h.Pairs[hk]; !ok {
+		h.Keys = append(h.Keys, hk)
+	}
+	h.Pairs[hk] = HashPair{Key: key, Value: val}
+}
+
+func (h *Hash) Delete(key Hashable) bool {
+	hk := key.HashKey()
+	if _, ok := h.Pairs[hk]; !ok {
+		return false
+	}
+
+	delete(h.Pairs, hk)
+	for i, k := range h.Keys {
+		if k == hk {
+			h.Keys = append(h.Keys[:i], h.Keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Ordered returns the pairs in insertion order.
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Keys))
+	for _, k := range h.Keys {
+		pairs = append(pairs, h.Pairs[k])
+	}
+	return pairs
+}
+
+func (h *Hash) Type() MetaType { return HASH }
+func (h *Hash) Echo() string   { return h.echo(map[Meta]bool{}) }
+
+// echo shows a hash that contains itself as {...} where it repeats.
+func (h *Hash) echo(seen map[Meta]bool) string {
+	if seen[h] {
+		return "{...}"
+	}
+	seen[h] = true
+	defer delete(seen, h)
+
+	pairs := []string{}
+	for _, pair := range h.Ordered() {
+		pairs = append(pairs, Inspect(pair.Key)+": "+inspect(pair.Value, seen))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// StructType is a struct type declared by a type statement, with the
+// methods declared on it so far.
+type StructType struct {
+	Name    string
+	Fields  []*ast.Identifier
+	Methods map[string]*Func
+}
+
+func (st *StructType) Type() MetaType { return TYPE }
+func (st *StructType) Echo() string   { return "type " + st.Name }
+
+// Field returns the declaration of the field name, nil if there is none.
+func (st *StructType) Field(name string) *ast.Identifier {
+	for _, f := range st.Fields {
+		if f.Value == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// InterfaceType is an interface type declared by a type statement, its
+// methods are function literals without a body.
+type InterfaceType struct {
+	Name    string
+	Methods []*ast.FunctionLiteral
+}
+
+func (it *InterfaceType) Type() MetaType { return TYPE }
+func (it *InterfaceType) Echo() string   { return "type " + it.Name }
+
+// Missing returns the first method of it that st doesn't implement with
+// the same parameter and return types, "" if st implements them all.
+func (it *InterfaceType) Missing(st *StructType) string {
+	for _, m := range it.Methods {
+		fn, ok := st.Methods[m.Name.Value]
+		if !ok || !sameSignature(fn, m) {
+			return m.Name.Value
+		}
+	}
+	return ""
+}
+
+// sameSignature compares the parameter types and the result types of fn
+// and of the interface method m, results without annotation match any.
+func sameSignature(fn *Func, m *ast.FunctionLiteral) bool {
+	if len(fn.Args) != len(m.Args) {
+		return false
+	}
+	for i := range fn.Args {
+		if fn.Args[i].Type.Value != m.Args[i].Type.Value {
+			return false
+		}
+	}
+
+	switch {
+	case fn.ReturnType == nil && fn.ReturnTypes == nil, m.ReturnType == nil && m.ReturnTypes == nil:
+		return true
+	case fn.ReturnType != nil || m.ReturnType != nil:
+		return fn.ReturnType != nil && m.ReturnType != nil && fn.ReturnType.Value == m.ReturnType.Value
+	}
+	if len(fn.ReturnTypes) != len(m.ReturnTypes) {
+		return false
+	}
+	for i := range fn.ReturnTypes {
+		if fn.ReturnTypes[i].Value != m.ReturnTypes[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// Struct is a value of a struct type. Like arrays and hashes, structs are
+// shared rather than copied by assignments and calls.
+type Struct struct {
+	Def    *StructType
+	Fields map[string]Meta
+}
+
+// Type is the name of the struct type, eg. Point.
+func (s *Struct) Type() MetaType { return MetaType(s.Def.Name) }
+func (s *Struct) Echo() string   { return s.echo(map[Meta]bool{}) }
+
+// echo shows a struct that contains itself as Name{...} where it repeats.
+func (s *Struct) echo(seen map[Meta]bool) string {
+	if seen[s] {
+		return s.Def.Name + "{...}"
+	}
+	seen[s] = true
+	defer delete(seen, s)
+
+	fields := []string{}
+	for _, f := range s.Def.Fields {
+		fields = append(fields, f.Value+": "+inspect(s.Fields[f.Value], seen))
+	}
+	return s.Def.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// EnumType is an enum declared by an enum statement.
+type EnumType struct {
+	Name     string
+	Variants []*ast.Variant
+}
+
+func (et *EnumType) Type() MetaType { return TYPE }
+func (et *EnumType) Echo() string   { return "enum " + et.Name }
+
+// Variant is a value of an enum, Values is the payload of its variant.
+type Variant struct {
+	Enum   *EnumType
+	Name   string
+	Values []Meta
+}
+
+// Type is the name of the enum, eg. Result.
+func (v *Variant) Type() MetaType { return MetaType(v.Enum.Name) }
+func (v *Variant) Echo() string   { return v.echo(map[Meta]bool{}) }
+
+func (v *Variant) echo(seen map[Meta]bool) string {
+	if len(v.Values) == 0 {
+		return v.Name
+	}
+	values := []string{}
+	for _, val := range v.Values {
+		values = append(values, inspect(val, seen))
+	}
+	return v.Name + "(" + strings.Join(values, ", ") + ")"
+}
+
+// Constructor creates the values of a variant with a payload: Ok(1).
+type Constructor struct {
+	Enum    *EnumType
+	Variant *ast.Variant
+}
+
+func (c *Constructor) Type() MetaType { return FUNC }
+func (c *Constructor) Echo() string   { return c.Enum.Name + "." + c.Variant.String() }
+
 type Nil struct{}
 
 func (n *Nil) Type() MetaType {
@@ -74,23 +404,94 @@ func (rv *ReturnValue) Echo() string {
 	return rv.Value.Echo()
 }
 
+// Break and Continue unwind the statements of a loop body up to the loop
+// named by Label, or the innermost loop when Label is empty.
+type Break struct {
+	Label string
+}
+
+func (b *Break) Type() MetaType { return BREAK }
+func (b *Break) Echo() string   { return "break" }
+
+type Continue struct {
+	Label string
+}
+
+func (c *Continue) Type() MetaType { return CONTINUE }
+func (c *Continue) Echo() string   { return "continue" }
+
+type ErrorKind string
+
+const (
+	TypeError      ErrorKind = "TypeError"
+	NameError      ErrorKind = "NameError"
+	ArityError     ErrorKind = "ArityError"
+	DivisionByZero ErrorKind = "DivisionByZero"
+	IndexError     ErrorKind = "IndexError"
+	ValueError     ErrorKind = "ValueError"
+)
+
+var errorCodes = map[ErrorKind]string{
+	TypeError:      diag.TypeError,
+	NameError:      diag.NameError,
+	ArityError:     diag.ArityError,
+	DivisionByZero: diag.DivisionByZero,
+	IndexError:     diag.IndexError,
+	ValueError:     diag.ValueError,
+}
+
+// Frame is one call on the way to a runtime error: the function that was
+// called and where it was called from.
+type Frame struct {
+	Func string
+	Pos  token.Position
+}
+
 type Error struct {
-	Msg string
+	Kind  ErrorKind
+	Msg   string
+	Pos   token.Position // 出错节点的位置
+	End   token.Position
+	Trace []Frame // 调用链，最内层的调用在前
 }
 
 func (e *Error) Type() MetaType {
 	return ERROR
 }
 func (e *Error) Echo() string {
-	return "syntax error: " + e.Msg
+	return string(e.Kind) + ": " + e.Msg
+}
+
+// Diagnostic converts the runtime error for printing with diag.Printer,
+// with the stack trace as notes.
+func (e *Error) Diagnostic() *diag.Diagnostic {
+	code, ok := errorCodes[e.Kind]
+	if !ok {
+		code = diag.RuntimeError
+	}
+
+	d := &diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     code,
+		Msg:      e.Echo(),
+		Pos:      e.Pos,
+		End:      e.End,
+	}
+	for _, f := range e.Trace {
+		d.Notes = append(d.Notes, fmt.Sprintf("in %s, called at %s", f.Func, f.Pos))
+	}
+	return d
 }
 
 type Func struct {
-	Name       *ast.Identifier
-	ReturnType *ast.Identifier
-	Args       []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Env
+	Receiver    *ast.Identifier // nil unless the func is a method
+	Name        *ast.Identifier
+	ReturnType  *ast.Identifier
+	ReturnTypes []*ast.Identifier // 返回多个值时的类型
+	Args        []*ast.Identifier
+	Body        *ast.BlockStatement
+	Env         *Env
+	Self        Meta // 方法绑定的接收者
 }
 
 func (f *Func) Type() MetaType { return FUNC }
@@ -103,6 +504,9 @@ func (f *Func) Echo() string {
 	}
 
 	out.WriteString("func")
+	if f.Receiver != nil {
+		out.WriteString(" (" + f.Receiver.Value + " " + f.Receiver.Type.Value + ")")
+	}
 	if f.Name != nil {
 		out.WriteString(" " + f.Name.Literal())
 	}
@@ -116,8 +520,9 @@ func (f *Func) Echo() string {
 }
 
 type Env struct {
-	store map[string]Meta
-	outer *Env
+	store  map[string]Meta
+	consts map[string]bool // 用 const 声明的名字
+	outer  *Env
 }
 
 func (e *Env) Get(name string) (Meta, bool) {
@@ -128,14 +533,32 @@ func (e *Env) Get(name string) (Meta, bool) {
 	return one, ok
 }
 
-func (e *Env) GetWithEnv(name string) (Meta, *Env) {
-	var outer *Env
-	one, ok := e.store[name]
-	if !ok && e.outer != nil {
-		one, _ = e.outer.Get(name)
-		outer = e.outer
+// Lookup returns the var name of e itself, without looking in the outer
+// envs.
+func (e *Env) Lookup(name string) (Meta, bool) {
+	val, ok := e.store[name]
+	return val, ok
+}
+
+// Ancestor returns the env depth levels out from e, the outermost env for a
+// depth of -1.
+func (e *Env) Ancestor(depth int) *Env {
+	for ; e.outer != nil && depth != 0; depth-- {
+		e = e.outer
 	}
-	return one, outer
+	return e
+}
+
+// Assign stores val into the var name of the innermost env that has one,
+// it reports false when there is none.
+func (e *Env) Assign(name string, val Meta) bool {
+	for ; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			e.store[name] = val
+			return true
+		}
+	}
+	return false
 }
 
 func (e *Env) Set(name string, val Meta) Meta {
@@ -143,6 +566,25 @@ func (e *Env) Set(name string, val Meta) Meta {
 	return val
 }
 
+// SetConst marks the var name of e as a constant, set already.
+func (e *Env) SetConst(name string) {
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+}
+
+// IsConst reports whether the var name of the innermost env that has one
+// is a constant.
+func (e *Env) IsConst(name string) bool {
+	for ; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			return e.consts[name]
+		}
+	}
+	return false
+}
+
 func NewEnv() *Env {
 	s := make(map[string]Meta)
 	return &Env{store: s, outer: nil}
@@ -2,15 +2,39 @@ package parser
 
 import (
 	"dao/ast"
+	"dao/diag"
 	"dao/lexer"
 	"dao/token"
+	"errors"
 	"fmt"
 	"strconv"
 )
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []*diag.Diagnostic
+
+	// labels of the loops enclosing the current statement, "" for loops
+	// without a label. break and continue are only valid inside a loop.
+	loops []string
+
+	// switches counts the switches enclosing the current statement inside
+	// the innermost function, a break there leaves the switch.
+	switches int
+
+	// noBrace is set in the header of if and for, where { starts the body
+	// rather than a hash literal.
+	noBrace bool
+
+	// panicking is set once the statement being parsed has reported an
+	// error; further errors are follow-on noise and are dropped until the
+	// parser has synchronized at the end of the statement.
+	panicking bool
+
+	// braces counts the { read before the current token and not closed
+	// yet. synchronize compares it with its count at the start of the
+	// statement to tell the braces of the statement from those around it.
+	braces int
 
 	curTok  token.Token
 	nextTok token.Token
@@ -25,32 +49,51 @@ type (
 )
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []*diag.Diagnostic{}}
 	p.prefixFNs = make(map[token.TokenType]prefixFN)
 	p.infixFNs = make(map[token.TokenType]infixFN)
 
 	p.registerPrefix(token.ID, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.NIL, p.parseNil)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	p.registerPrefix(token.FUNC, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.MOD, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LE, p.parseInfixExpression)
+	p.registerInfix(token.GE, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AMP, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.AND_NOT, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NEQ, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.DOT, p.parseSelectorExpression)
 
 	p.Next()
 	p.Next()
@@ -59,15 +102,50 @@ func New(l *lexer.Lexer) *Parser {
 }
 
 func (p *Parser) Errors() []string {
+	msgs := []string{}
+	for _, d := range p.errors {
+		msgs = append(msgs, d.Error())
+	}
+	return msgs
+}
+
+func (p *Parser) Diagnostics() []*diag.Diagnostic {
 	return p.errors
 }
 
+// errorAt records an error spanning tok.
+func (p *Parser) errorAt(tok token.Token, code string, format string, a ...interface{}) *diag.Diagnostic {
+	d := &diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     code,
+		Msg:      fmt.Sprintf(format, a...),
+		Pos:      tok.Pos,
+		End:      tok.End,
+	}
+	if !p.panicking {
+		p.errors = append(p.errors, d)
+		p.panicking = true
+	}
+	return d
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expect next token to be %s, got %s instead", t, p.nextTok.Type)
-	p.errors = append(p.errors, msg)
+	if p.nextTok.Type == token.ILLEGAL {
+		p.errorAt(p.nextTok, diag.IllegalToken, "%s", p.nextTok.Literal)
+		return
+	}
+	p.errorAt(p.nextTok, diag.UnexpectedToken, "expect next token to be %s, got %s instead", t, p.nextTok.Type)
 }
 
 func (p *Parser) Next() {
+	switch p.curTok.Type {
+	case token.LBRACE:
+		p.braces++
+	case token.RBRACE:
+		if p.braces > 0 {
+			p.braces--
+		}
+	}
 	p.curTok = p.nextTok
 	p.nextTok = p.l.Next()
 }
@@ -77,7 +155,7 @@ func (p *Parser) Parse() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+		stmt, _ := p.parseStatementRecover()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -87,26 +165,121 @@ func (p *Parser) Parse() *ast.Program {
 	return program
 }
 
+// parseStatementRecover parses a statement. A statement with a syntax error
+// is dropped and the parser skips to its last token so that parsing can go
+// on with the next one. closed reports that the parser stopped at the '}' of
+// the enclosing block, which is then left as the current token.
+func (p *Parser) parseStatementRecover() (stmt ast.Statement, closed bool) {
+	start := p.braces
+	stmt = p.parseStatement()
+	if !p.panicking {
+		return stmt, false
+	}
+
+	closed = p.synchronize(start)
+	p.panicking = false
+	return nil, closed
+}
+
+// synchronize skips tokens up to a statement boundary: a semicolon, the end
+// of a line, a closing brace or a keyword that starts a statement. The
+// braces opened by the statement, which began with start braces open, are
+// skipped as a whole, before the error as well as after it: the } of a
+// hash literal or a match is not the end of a block.
+func (p *Parser) synchronize(start int) bool {
+	for {
+		depth := p.braces - start
+		switch p.curTok.Type {
+		case token.EOF:
+			return false
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth <= 0 {
+				return true
+			}
+			depth--
+		}
+
+		if depth == 0 && p.atStatementEnd() {
+			return false
+		}
+		p.Next()
+	}
+}
+
+func (p *Parser) atStatementEnd() bool {
+	switch {
+	case p.curTokenIs(token.SEMICOLON):
+		return true
+	case p.nextTokenIs(token.RBRACE), p.nextTokenIs(token.EOF):
+		return true
+	case p.nextTok.Pos.Line > p.curTok.End.Line:
+		return true
+	}
+	return statementKeywords[p.nextTok.Type]
+}
+
+var statementKeywords = map[token.TokenType]bool{
+	token.VAR:      true,
+	token.CONST:    true,
+	token.RETURN:   true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+	token.TYPE:     true,
+	token.ENUM:     true,
+	token.SWITCH:   true,
+	token.CASE:     true,
+	token.DEFAULT:  true,
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curTok.Type {
 	case token.VAR:
 		return p.parseVarStatement()
+	case token.CONST:
+		return p.parseConstStatement()
 	case token.ID:
-		if p.nextTok.Type == token.ASSIGN {
+		if isAssignOp(p.nextTok.Type) {
 			return p.parseAssignStatement()
 		}
+		if p.nextTok.Type == token.COLON {
+			return p.parseLabeledStatement()
+		}
 		return p.parseExpressionStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	case token.FOR:
-		return p.parseForStatement()
+		return p.parseForStatement(nil)
+	case token.BREAK, token.CONTINUE:
+		return p.parseBranchStatement()
+	case token.TYPE:
+		return p.parseTypeStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
+	case token.SWITCH:
+		return p.parseSwitchStatement()
+	case token.FALLTHROUGH:
+		p.errorAt(p.curTok, diag.BadBranch, "fallthrough statement out of place")
+		return nil
+	case token.CASE, token.DEFAULT:
+		p.errorAt(p.curTok, diag.UnexpectedToken, "%s is not in a switch", p.curTok.Literal)
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseVarStatement() *ast.VarStatement {
-	stmt := &ast.VarStatement{Token: p.curTok}
+	return p.parseVarSpec(p.curTok)
+}
+
+// parseVarSpec parses name [type] = value, tok is the var or the const
+// declaring it. A var may declare several names, with a type for them all,
+// and take several values: var q, r int = f()
+func (p *Parser) parseVarSpec(tok token.Token) *ast.VarStatement {
+	stmt := &ast.VarStatement{Token: tok}
 
 	if !p.expectNext(token.ID) {
 		return nil
@@ -114,9 +287,23 @@ func (p *Parser) parseVarStatement() *ast.VarStatement {
 
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 
+	if tok.Type == token.VAR && p.nextTokenIs(token.COMMA) {
+		stmt.Names = []*ast.Identifier{stmt.Name}
+		for p.nextTokenIs(token.COMMA) {
+			p.Next()
+			if !p.expectNext(token.ID) {
+				return nil
+			}
+			stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal})
+		}
+		stmt.Name = nil
+	}
+
 	if p.nextTokenIs(token.ID) {
 		p.Next()
-		stmt.Name.Type = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		for _, name := range stmt.Idents() {
+			name.Type = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		}
 	}
 
 	if !p.expectNext(token.ASSIGN) {
@@ -125,6 +312,210 @@ func (p *Parser) parseVarStatement() *ast.VarStatement {
 
 	p.Next()
 	stmt.Value = p.parseExpression(LOWEST)
+	if tok.Type == token.VAR {
+		stmt.Value = p.parseTuple(stmt.Value)
+	}
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+
+	return stmt
+}
+
+// parseConstStatement parses const A = 1, or a group of specs separated by
+// semicolons or new lines: const ( A = 1; B = 2 ).
+func (p *Parser) parseConstStatement() ast.Statement {
+	stmt := &ast.ConstStatement{Token: p.curTok}
+
+	if !p.nextTokenIs(token.LPAREN) {
+		spec := p.parseVarSpec(stmt.Token)
+		if spec == nil {
+			return nil
+		}
+		stmt.Specs = []*ast.VarStatement{spec}
+		return stmt
+	}
+
+	p.Next()
+	for !p.nextTokenIs(token.RPAREN) {
+		if p.nextTokenIs(token.EOF) {
+			p.errorAt(p.nextTok, diag.Unclosed, "unclosed const group, expect ) before end of file")
+			return nil
+		}
+		spec := p.parseVarSpec(stmt.Token)
+		if spec == nil {
+			return nil
+		}
+		stmt.Specs = append(stmt.Specs, spec)
+	}
+	p.Next()
+	stmt.Rparen = p.curTok
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTypeStatement() ast.Statement {
+	stmt := &ast.TypeStatement{Token: p.curTok}
+
+	if !p.expectNext(token.ID) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+
+	switch {
+	case p.nextTokenIs(token.STRUCT):
+		p.Next()
+		stmt.Type = p.parseStructType()
+	case p.nextTokenIs(token.INTERFACE):
+		p.Next()
+		stmt.Type = p.parseInterfaceType()
+	default:
+		p.errorAt(p.nextTok, diag.UnexpectedToken, "expect struct or interface after type %s, got %s instead", stmt.Name.Value, p.nextTok.Type)
+		return nil
+	}
+	if stmt.Type == nil {
+		return nil
+	}
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+
+	return stmt
+}
+
+// parseStructType parses struct { x int; y int }, the semicolons between
+// the fields are optional.
+func (p *Parser) parseStructType() ast.Expression {
+	st := &ast.StructType{Token: p.curTok}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for !p.nextTokenIs(token.RBRACE) {
+		if !p.expectNext(token.ID) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		if seen[field.Value] {
+			p.errorAt(field.Token, diag.DuplicateName, "duplicate field %s", field.Value)
+			return nil
+		}
+		seen[field.Value] = true
+
+		if !p.expectNext(token.ID) {
+			return nil
+		}
+		field.Type = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		st.Fields = append(st.Fields, field)
+
+		if p.nextTokenIs(token.SEMICOLON) {
+			p.Next()
+		}
+	}
+
+	p.Next()
+	st.Rbrace = p.curTok
+
+	return st
+}
+
+// parseInterfaceType parses interface { area() int; scale(f int) }, the
+// semicolons between the methods are optional.
+func (p *Parser) parseInterfaceType() ast.Expression {
+	it := &ast.InterfaceType{Token: p.curTok}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for !p.nextTokenIs(token.RBRACE) {
+		if !p.expectNext(token.ID) {
+			return nil
+		}
+		m := &ast.FunctionLiteral{Token: p.curTok, Name: &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}}
+		if seen[m.Name.Value] {
+			p.errorAt(m.Name.Token, diag.DuplicateName, "duplicate method %s", m.Name.Value)
+			return nil
+		}
+		seen[m.Name.Value] = true
+
+		if !p.expectNext(token.LPAREN) {
+			return nil
+		}
+		m.Args = p.parseFunctionArgs()
+		if m.Args == nil || !p.parseResults(m) {
+			return nil
+		}
+		it.Methods = append(it.Methods, m)
+
+		if p.nextTokenIs(token.SEMICOLON) {
+			p.Next()
+		}
+	}
+
+	p.Next()
+	it.Rbrace = p.curTok
+
+	return it
+}
+
+// parseEnumStatement parses enum Result { Ok(v), Err(msg) }, the commas
+// between the variants are optional.
+func (p *Parser) parseEnumStatement() ast.Statement {
+	stmt := &ast.EnumStatement{Token: p.curTok}
+
+	if !p.expectNext(token.ID) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for !p.nextTokenIs(token.RBRACE) {
+		if !p.expectNext(token.ID) {
+			return nil
+		}
+		v := &ast.Variant{Name: &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}}
+		if seen[v.Name.Value] {
+			p.errorAt(v.Name.Token, diag.DuplicateName, "duplicate variant %s", v.Name.Value)
+			return nil
+		}
+		seen[v.Name.Value] = true
+
+		if p.nextTokenIs(token.LPAREN) {
+			p.Next()
+			for len(v.Fields) == 0 || p.nextTokenIs(token.COMMA) {
+				if len(v.Fields) > 0 {
+					p.Next()
+				}
+				if !p.expectNext(token.ID) {
+					return nil
+				}
+				v.Fields = append(v.Fields, &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal})
+			}
+			if !p.expectNext(token.RPAREN) {
+				return nil
+			}
+		}
+		stmt.Variants = append(stmt.Variants, v)
+
+		if p.nextTokenIs(token.COMMA) || p.nextTokenIs(token.SEMICOLON) {
+			p.Next()
+		}
+	}
+
+	p.Next()
+	stmt.Rbrace = p.curTok
 
 	if p.nextTokenIs(token.SEMICOLON) {
 		p.Next()
@@ -137,13 +528,359 @@ func (p *Parser) parseAssignStatement() *ast.AssignStatement {
 	stmt := &ast.AssignStatement{Token: p.curTok}
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 
-	if !p.expectNext(token.ASSIGN) {
+	p.Next()
+	stmt.Operator = p.curTok.Literal
+	p.Next()
+
+	stmt.Value = p.parseTuple(p.parseExpression(LOWEST))
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Token: p.curTok}
+
+	p.Next()
+
+	stmt.ReturnValue = p.parseTuple(p.parseExpression(LOWEST))
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseLabeledStatement() ast.Statement {
+	label := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.Next()
+
+	if !p.nextTokenIs(token.FOR) {
+		p.errorAt(p.nextTok, diag.UnexpectedToken, "label %s must be followed by a for loop", label.Value)
 		return nil
 	}
+	for _, l := range p.loops {
+		if l == label.Value {
+			p.errorAt(label.Token, diag.BadBranch, "label %s already defined", label.Value)
+			return nil
+		}
+	}
 
 	p.Next()
+	return p.parseForStatement(label)
+}
 
-	stmt.Value = p.parseExpression(LOWEST)
+// parseBranchStatement parses break and continue with an optional label,
+// which must name one of the enclosing loops. An unlabeled break may also
+// leave a switch.
+func (p *Parser) parseBranchStatement() ast.Statement {
+	tok := p.curTok
+
+	var label *ast.Identifier
+	if p.nextTokenIs(token.ID) && p.nextTok.Pos.Line == tok.Pos.Line {
+		p.Next()
+		label = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	}
+
+	if tok.Type == token.BREAK && label == nil && p.switches > 0 {
+		// leaves the switch
+	} else if len(p.loops) == 0 {
+		p.errorAt(tok, diag.BadBranch, "%s is not in a loop", tok.Literal)
+		return nil
+	}
+	if label != nil && !p.inLoop(label.Value) {
+		p.errorAt(label.Token, diag.BadBranch, "%s label not defined: %s", tok.Literal, label.Value)
+		return nil
+	}
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok, Label: label}
+	}
+	return &ast.ContinueStatement{Token: tok, Label: label}
+}
+
+func (p *Parser) inLoop(label string) bool {
+	for _, l := range p.loops {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) parseForStatement(label *ast.Identifier) *ast.ForStatement {
+	forStmt := &ast.ForStatement{Token: p.curTok, Label: label}
+	p.Next()
+
+	stmts := []ast.Statement{}
+	if p.curTokenIs(token.ID) && (p.nextTokenIs(token.COMMA) || p.nextTokenIs(token.IN)) {
+		if !p.parseRangeClause(forStmt) {
+			return nil
+		}
+		forStmt.Body = p.parseLoopBody(label)
+	} else if p.curTokenIs(token.LBRACE) {
+		forStmt.Condition = stmts
+		forStmt.Body = p.parseLoopBody(label)
+	} else {
+		noBrace := p.noBrace
+		p.noBrace = true
+		defer func() { p.noBrace = noBrace }()
+
+		for !p.curTokenIs(token.LBRACE) {
+			if p.curTokenIs(token.EOF) {
+				p.errorAt(p.curTok, diag.UnexpectedToken, "expect { after for clauses, got EOF instead")
+				return nil
+			}
+			stmt := p.parseStatement()
+			if p.panicking {
+				return nil
+			}
+			stmts = append(stmts, stmt)
+			p.Next()
+			if p.curTokenIs(token.SEMICOLON) {
+				p.Next()
+			}
+		}
+
+		forStmt.Condition = stmts
+		forStmt.Body = p.parseLoopBody(label)
+	}
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+	return forStmt
+}
+
+// parseSwitchStatement parses switch tag { case a, b: ... default: ... }
+// and the switch without tag, switch { case cond: ... }.
+func (p *Parser) parseSwitchStatement() ast.Statement {
+	stmt := &ast.SwitchStatement{Token: p.curTok}
+
+	if !p.nextTokenIs(token.LBRACE) {
+		p.Next()
+		stmt.Tag = p.parseHeaderExpression()
+	}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	lbrace := p.curTok
+	p.Next()
+
+	noBrace := p.noBrace
+	p.noBrace = false
+	p.switches++
+	defer func() {
+		p.noBrace = noBrace
+		p.switches--
+	}()
+
+	var def *ast.CaseClause
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		clause := p.parseCaseClause()
+		if clause == nil {
+			continue
+		}
+		if clause.Values == nil {
+			if def != nil {
+				p.errorAt(clause.Token, diag.DuplicateName, "multiple defaults in switch")
+				p.panicking = false
+			}
+			def = clause
+		}
+		stmt.Cases = append(stmt.Cases, clause)
+	}
+
+	if p.curTokenIs(token.EOF) {
+		d := p.errorAt(lbrace, diag.Unclosed, "unclosed switch, expect } before end of file")
+		d.Hint = "add a } to close this switch"
+		return nil
+	}
+	stmt.Rbrace = p.curTok
+
+	if n := len(stmt.Cases); n > 0 && stmt.Cases[n-1].Fallthrough() {
+		body := stmt.Cases[n-1].Body.Statements
+		p.errorAt(body[len(body)-1].(*ast.FallthroughStatement).Token, diag.BadBranch, "cannot fallthrough final case in switch")
+		p.panicking = false
+	}
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+
+	return stmt
+}
+
+// parseCaseClause parses a case or the default of a switch, up to the
+// case, default or } that follows it. A clause with an error in its values
+// is skipped and nil is returned.
+func (p *Parser) parseCaseClause() *ast.CaseClause {
+	clause := &ast.CaseClause{Token: p.curTok}
+
+	switch p.curTok.Type {
+	case token.CASE:
+		p.Next()
+		clause.Values = []ast.Expression{p.parseExpression(LOWEST)}
+		for p.nextTokenIs(token.COMMA) {
+			p.Next()
+			p.Next()
+			clause.Values = append(clause.Values, p.parseExpression(LOWEST))
+		}
+	case token.DEFAULT:
+	default:
+		p.errorAt(p.curTok, diag.UnexpectedToken, "expect case or default, got %s instead", p.curTok.Type)
+	}
+	if p.panicking || !p.expectNext(token.COLON) {
+		p.skipClause()
+		return nil
+	}
+
+	clause.Body = &ast.BlockStatement{Token: p.curTok, Statements: []ast.Statement{}}
+	p.Next()
+
+	for !p.atClauseEnd() {
+		if p.curTokenIs(token.FALLTHROUGH) {
+			clause.Body.Statements = append(clause.Body.Statements, &ast.FallthroughStatement{Token: p.curTok})
+			if p.nextTokenIs(token.SEMICOLON) {
+				p.Next()
+			}
+			p.Next()
+			if !p.atClauseEnd() {
+				p.errorAt(clause.Body.Statements[len(clause.Body.Statements)-1].(*ast.FallthroughStatement).Token, diag.BadBranch, "fallthrough statement out of place")
+				p.panicking = false
+			}
+			continue
+		}
+
+		stmt, closed := p.parseStatementRecover()
+		if stmt != nil {
+			clause.Body.Statements = append(clause.Body.Statements, stmt)
+		}
+		if closed {
+			break
+		}
+		p.Next()
+	}
+
+	return clause
+}
+
+func (p *Parser) atClauseEnd() bool {
+	switch p.curTok.Type {
+	case token.CASE, token.DEFAULT, token.RBRACE, token.EOF:
+		return true
+	}
+	return false
+}
+
+// skipClause skips the rest of a clause with an error, braces opened along
+// the way are skipped as a whole.
+func (p *Parser) skipClause() {
+	depth := 0
+	for {
+		p.Next()
+		switch p.curTok.Type {
+		case token.EOF:
+			p.panicking = false
+			return
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				p.panicking = false
+				return
+			}
+			depth--
+		case token.CASE, token.DEFAULT:
+			if depth == 0 {
+				p.panicking = false
+				return
+			}
+		}
+	}
+}
+
+// parseRangeClause parses the k, v in x of a range loop, leaving the
+// parser on the { of the body.
+func (p *Parser) parseRangeClause(forStmt *ast.ForStatement) bool {
+	forStmt.Value = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	if p.nextTokenIs(token.COMMA) {
+		p.Next()
+		if !p.expectNext(token.ID) {
+			return false
+		}
+		forStmt.Key = forStmt.Value
+		forStmt.Value = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	}
+	if !p.expectNext(token.IN) {
+		return false
+	}
+
+	p.Next()
+	forStmt.Range = p.parseHeaderExpression()
+	return p.expectNext(token.LBRACE)
+}
+
+func (p *Parser) parseLoopBody(label *ast.Identifier) *ast.BlockStatement {
+	name := ""
+	if label != nil {
+		name = label.Value
+	}
+
+	p.loops = append(p.loops, name)
+	defer func() { p.loops = p.loops[:len(p.loops)-1] }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
+	stmt := &ast.ExpressionStatement{Token: p.curTok}
+	stmt.Expression = p.parseExpression(LOWEST)
+
+	if isAssignOp(p.nextTok.Type) {
+		return p.parseTargetAssignStatement(stmt.Expression)
+	}
+	if p.nextTokenIs(token.COMMA) {
+		return p.parseTupleAssignStatement(stmt.Expression)
+	}
+	if p.nextTokenIs(token.INC) || p.nextTokenIs(token.DEC) {
+		return p.parseIncDecStatement(stmt.Expression)
+	}
+
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.Next()
+	}
+
+	return stmt
+}
+
+// parseTargetAssignStatement parses the assignment to an element or a
+// field, eg. a[i] = v or p.x = v, whose left side has already been parsed
+// as target.
+func (p *Parser) parseTargetAssignStatement(target ast.Expression) ast.Statement {
+	switch target.(type) {
+	case *ast.IndexExpression, *ast.SelectorExpression:
+	default:
+		if target != nil {
+			p.errorAt(p.nextTok, diag.UnexpectedToken, "cannot assign to %s", target.String())
+		}
+		return nil
+	}
+
+	stmt := &ast.AssignStatement{Token: p.curTok, Target: target}
+	p.Next()
+	stmt.Operator = p.curTok.Literal
+	p.Next()
+
+	stmt.Value = p.parseTuple(p.parseExpression(LOWEST))
 
 	if p.nextTokenIs(token.SEMICOLON) {
 		p.Next()
@@ -152,12 +889,41 @@ func (p *Parser) parseAssignStatement() *ast.AssignStatement {
 	return stmt
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	stmt := &ast.ReturnStatement{Token: p.curTok}
+// parseTupleAssignStatement parses the assignment to several targets,
+// a, b = b, a, whose first target has already been parsed as first.
+func (p *Parser) parseTupleAssignStatement(first ast.Expression) ast.Statement {
+	if first == nil {
+		return nil
+	}
+
+	stmt := &ast.AssignStatement{Targets: []ast.Expression{first}}
+	for p.nextTokenIs(token.COMMA) {
+		p.Next()
+		p.Next()
+		target := p.parseExpression(LOWEST)
+		if target == nil {
+			return nil
+		}
+		stmt.Targets = append(stmt.Targets, target)
+	}
+
+	for _, target := range stmt.Targets {
+		switch target.(type) {
+		case *ast.Identifier, *ast.IndexExpression, *ast.SelectorExpression:
+		default:
+			p.errorAt(p.nextTok, diag.UnexpectedToken, "cannot assign to %s", target.String())
+			return nil
+		}
+	}
 
+	if !p.expectNext(token.ASSIGN) {
+		return nil
+	}
+	stmt.Token = p.curTok
+	stmt.Operator = p.curTok.Literal
 	p.Next()
 
-	stmt.ReturnValue = p.parseExpression(LOWEST)
+	stmt.Value = p.parseTuple(p.parseExpression(LOWEST))
 
 	if p.nextTokenIs(token.SEMICOLON) {
 		p.Next()
@@ -166,39 +932,40 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
-func (p *Parser) parseForStatement() *ast.ForStatement {
-	forStmt := &ast.ForStatement{Token: p.curTok}
-	p.Next()
-
-	stmts := []ast.Statement{}
-	if p.curTokenIs(token.LBRACE) {
-		forStmt.Condition = stmts
-		forStmt.Body = p.parseBlockStatement()
-	} else {
-		for !p.curTokenIs(token.LBRACE) {
-			stmt := p.parseStatement()
-			if stmt != nil {
-				stmts = append(stmts, stmt)
-			}
-			p.Next()
-			if p.curTokenIs(token.SEMICOLON) {
-				p.Next()
-			}
-		}
-
-		forStmt.Condition = stmts
-		forStmt.Body = p.parseBlockStatement()
+// parseTuple parses the values separated by commas following first, the
+// value just parsed: return q, r. It returns first when there are none.
+func (p *Parser) parseTuple(first ast.Expression) ast.Expression {
+	if first == nil || !p.nextTokenIs(token.COMMA) {
+		return first
 	}
 
-	if p.nextTokenIs(token.SEMICOLON) {
+	tuple := &ast.TupleLiteral{Token: p.nextTok, Elements: []ast.Expression{first}}
+	for p.nextTokenIs(token.COMMA) {
+		p.Next()
 		p.Next()
+		el := p.parseExpression(LOWEST)
+		if el == nil {
+			return nil
+		}
+		tuple.Elements = append(tuple.Elements, el)
 	}
-	return forStmt
+	return tuple
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{Token: p.curTok}
-	stmt.Expression = p.parseExpression(LOWEST)
+// parseIncDecStatement parses x++, a[i]-- and p.x++, target is what has
+// been parsed before the operator.
+func (p *Parser) parseIncDecStatement(target ast.Expression) ast.Statement {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression, *ast.SelectorExpression:
+	default:
+		if target != nil {
+			p.errorAt(p.nextTok, diag.UnexpectedToken, "cannot %s %s", p.nextTok.Literal, target.String())
+		}
+		return nil
+	}
+
+	p.Next()
+	stmt := &ast.IncDecStatement{Token: p.curTok, Target: target}
 
 	if p.nextTokenIs(token.SEMICOLON) {
 		p.Next()
@@ -207,9 +974,17 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	return stmt
 }
 
+func isAssignOp(t token.TokenType) bool {
+	switch t {
+	case token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN,
+		token.ASTERISK_ASSIGN, token.SLASH_ASSIGN, token.MOD_ASSIGN:
+		return true
+	}
+	return false
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curTok, diag.NoExpression, "expect an expression, got %s instead", t)
 }
 
 func (p *Parser) parseExpression(pb int) ast.Expression {
@@ -260,6 +1035,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	noBrace := p.noBrace
+	p.noBrace = false
+	defer func() { p.noBrace = noBrace }()
+
 	p.Next()
 	exp := p.parseExpression(LOWEST)
 	if !p.expectNext(token.RPAREN) {
@@ -268,8 +1047,89 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
+// parseHeaderExpression parses the condition of an if, in which a hash
+// literal has to be put in parentheses: if x == ({}) {}
+func (p *Parser) parseHeaderExpression() ast.Expression {
+	noBrace := p.noBrace
+	p.noBrace = true
+	defer func() { p.noBrace = noBrace }()
+
+	return p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	ident := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+
+	// Point{x: 1}, unless the { opens the body of an if or a for
+	if p.nextTokenIs(token.LBRACE) && !p.noBrace && p.nextTok.Pos.Line == p.curTok.End.Line {
+		p.Next()
+		return p.parseStructLiteral(ident)
+	}
+	return ident
+}
+
+// parseStructLiteral parses the {x: 1, y: 2} following the name of a
+// struct type, a trailing comma is allowed.
+func (p *Parser) parseStructLiteral(name *ast.Identifier) ast.Expression {
+	lit := &ast.StructLiteral{Token: p.curTok, Name: name}
+
+	noBrace := p.noBrace
+	p.noBrace = false
+	defer func() { p.noBrace = noBrace }()
+
+	seen := map[string]bool{}
+	for !p.nextTokenIs(token.RBRACE) {
+		if !p.expectNext(token.ID) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		if seen[field.Value] {
+			p.errorAt(field.Token, diag.DuplicateName, "duplicate field %s in struct literal", field.Value)
+			return nil
+		}
+		seen[field.Value] = true
+
+		if !p.expectNext(token.COLON) {
+			return nil
+		}
+		p.Next()
+		lit.Fields = append(lit.Fields, field)
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.nextTokenIs(token.RBRACE) && !p.expectNext(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.Next()
+	lit.Rbrace = p.curTok
+
+	return lit
+}
+
+// parseSelectorExpression parses the field or method name after a dot, or
+// the type of a type assertion: s.(Circle)
+func (p *Parser) parseSelectorExpression(left ast.Expression) ast.Expression {
+	if p.nextTokenIs(token.LPAREN) {
+		ta := &ast.TypeAssertion{Token: p.curTok, Left: left}
+		p.Next()
+		if !p.expectNext(token.ID) {
+			return nil
+		}
+		ta.Type = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		if !p.expectNext(token.RPAREN) {
+			return nil
+		}
+		ta.Rparen = p.curTok
+		return ta
+	}
+
+	sel := &ast.SelectorExpression{Token: p.curTok, Left: left}
+	if !p.expectNext(token.ID) {
+		return nil
+	}
+	sel.Field = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	return sel
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
@@ -288,9 +1148,33 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curTok}
 
 	value, err := strconv.ParseInt(p.curTok.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		d := p.errorAt(p.curTok, diag.BadLiteral, "integer literal %s overflows int", p.curTok.Literal)
+		d.Hint = "the largest int is 9223372036854775807, use a float for bigger numbers"
+		return nil
+	}
+	if err != nil {
+		p.errorAt(p.curTok, diag.BadLiteral, "invalid integer literal %s", p.curTok.Literal)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+// parseIllegal reports the error the lexer left in an ILLEGAL token.
+func (p *Parser) parseIllegal() ast.Expression {
+	p.errorAt(p.curTok, diag.IllegalToken, "%s", p.curTok.Literal)
+	return nil
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curTok}
+
+	value, err := strconv.ParseFloat(p.curTok.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curTok.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curTok, diag.BadLiteral, "invalid float literal %s", p.curTok.Literal)
 		return nil
 	}
 
@@ -303,7 +1187,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curTok}
 
 	p.Next()
-	expression.Condition = p.parseExpression(LOWEST)
+	expression.Condition = p.parseHeaderExpression()
 
 	if !p.expectNext(token.LBRACE) {
 		return nil
@@ -328,11 +1212,142 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseMatchExpression parses match x { pattern => body, ... }. A body is
+// an expression, followed by a comma unless it is the last arm, or a block.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	m := &ast.MatchExpression{Token: p.curTok}
+
+	p.Next()
+	m.Subject = p.parseHeaderExpression()
+
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+
+	noBrace := p.noBrace
+	p.noBrace = false
+	defer func() { p.noBrace = noBrace }()
+
+	for !p.nextTokenIs(token.RBRACE) {
+		p.Next()
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if p.panicking || !p.expectNext(token.ARROW) {
+			return nil
+		}
+
+		p.Next()
+		if p.curTokenIs(token.LBRACE) {
+			arm.Body = p.parseBlockStatement()
+			if p.nextTokenIs(token.COMMA) {
+				p.Next()
+			}
+		} else {
+			stmt := &ast.ExpressionStatement{Token: p.curTok, Expression: p.parseExpression(LOWEST)}
+			arm.Body = &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+			if !p.nextTokenIs(token.RBRACE) && !p.expectNext(token.COMMA) {
+				return nil
+			}
+		}
+		m.Arms = append(m.Arms, arm)
+	}
+
+	p.Next()
+	m.Rbrace = p.curTok
+
+	return m
+}
+
+// parsePattern parses the pattern of a match arm: _, a name, a literal,
+// an array of patterns or a variant with patterns for its payload.
+func (p *Parser) parsePattern() ast.Expression {
+	switch p.curTok.Type {
+	case token.ID:
+		ident := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		if !p.nextTokenIs(token.LPAREN) {
+			return ident
+		}
+		p.Next()
+		call := &ast.CallExpression{Token: p.curTok, Function: ident}
+		call.Args = p.parsePatternList(token.RPAREN)
+		call.Rparen = p.curTok
+		return call
+	case token.LBRACKET:
+		array := &ast.ArrayLiteral{Token: p.curTok}
+		array.Elements = p.parsePatternList(token.RBRACKET)
+		array.Rbracket = p.curTok
+		return array
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.NIL:
+		return p.prefixFNs[p.curTok.Type]()
+	case token.MINUS:
+		if !p.nextTokenIs(token.INT) && !p.nextTokenIs(token.FLOAT) {
+			p.errorAt(p.nextTok, diag.UnexpectedToken, "expect a number after - in a pattern, got %s instead", p.nextTok.Type)
+			return nil
+		}
+		exp := &ast.PrefixExpression{Token: p.curTok, Operator: "-"}
+		p.Next()
+		exp.Right = p.prefixFNs[p.curTok.Type]()
+		return exp
+	}
+
+	p.errorAt(p.curTok, diag.NoExpression, "expect a pattern, got %s instead", p.curTok.Type)
+	return nil
+}
+
+// parsePatternList parses comma separated patterns up to the end token.
+// The patterns of an array may end with ..rest, which matches the
+// remaining elements.
+func (p *Parser) parsePatternList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	for !p.nextTokenIs(end) {
+		p.Next()
+		if end == token.RBRACKET && p.curTokenIs(token.DOT) {
+			rest := p.parseRestPattern()
+			if rest == nil {
+				return nil
+			}
+			list = append(list, rest)
+			if !p.nextTokenIs(end) {
+				p.errorAt(p.nextTok, diag.UnexpectedToken, "%s must be the last pattern of an array", rest.String())
+				return nil
+			}
+			break
+		}
+
+		pattern := p.parsePattern()
+		if pattern == nil {
+			return nil
+		}
+		list = append(list, pattern)
+
+		if !p.nextTokenIs(end) && !p.expectNext(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.Next()
+	return list
+}
+
+func (p *Parser) parseRestPattern() *ast.RestPattern {
+	first := p.curTok
+	if !p.expectNext(token.DOT) {
+		return nil
+	}
+
+	rest := &ast.RestPattern{Token: token.Token{Type: token.DOT, Literal: "..", Pos: first.Pos, End: p.curTok.End}}
+	if p.nextTokenIs(token.ID) {
+		p.Next()
+		rest.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	}
+	return rest
+}
+
 func (p *Parser) parseElifExpression(ifexp *ast.IfExpression) *ast.IfExpression {
 	expression := &ast.IfExpression{Token: p.curTok}
 
 	p.Next()
-	expression.Condition = p.parseExpression(LOWEST)
+	expression.Condition = p.parseHeaderExpression()
 
 	if !p.expectNext(token.LBRACE) {
 		return nil
@@ -361,16 +1376,36 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curTok}
 	block.Statements = []ast.Statement{}
 
+	noBrace := p.noBrace
+	p.noBrace = false
+	defer func() { p.noBrace = noBrace }()
+
 	p.Next()
 
+	// errors inside the block are recovered here, the state of the
+	// statement owning the block is restored afterwards.
+	panicking := p.panicking
+	p.panicking = false
+
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+		stmt, closed := p.parseStatementRecover()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if closed {
+			break
+		}
 		p.Next()
 	}
 
+	if p.curTokenIs(token.EOF) {
+		d := p.errorAt(block.Token, diag.Unclosed, "unclosed block, expect } before end of file")
+		d.Hint = "add a } to close this block"
+	}
+
+	p.panicking = p.panicking || panicking
+	block.Rbrace = p.curTok
+
 	if p.nextTokenIs(token.SEMICOLON) {
 		p.Next()
 	}
@@ -391,20 +1426,74 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 
 	fn.Args = p.parseFunctionArgs()
 
-	if p.nextTokenIs(token.ID) {
+	// func (p Point) norm() {}: the first parameter list was the receiver
+	// of a method if a name and another list follow it.
+	if fn.Name == nil && p.nextTokenIs(token.ID) {
 		p.Next()
-		fn.ReturnType = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		ident := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		if !p.nextTokenIs(token.LPAREN) {
+			fn.ReturnType = ident
+		} else {
+			if len(fn.Args) != 1 {
+				p.errorAt(ident.Token, diag.UnexpectedToken, "method %s must have exactly one receiver", ident.Value)
+				return nil
+			}
+			fn.Receiver, fn.Name = fn.Args[0], ident
+			p.Next()
+			fn.Args = p.parseFunctionArgs()
+		}
+	}
+
+	if fn.ReturnType == nil && !p.parseResults(fn) {
+		return nil
 	}
 
 	if !p.expectNext(token.LBRACE) {
 		return nil
 	}
 
+	// a function body starts outside of any loop or switch
+	loops, switches := p.loops, p.switches
+	p.loops, p.switches = nil, 0
 	fn.Body = p.parseBlockStatement()
+	p.loops, p.switches = loops, switches
 
 	return fn
 }
 
+// parseResults parses the result types following the parameters of fn, a
+// type or a list of them in parentheses: func divmod(a int, b int) (int, int)
+func (p *Parser) parseResults(fn *ast.FunctionLiteral) bool {
+	if p.nextTokenIs(token.ID) {
+		p.Next()
+		fn.ReturnType = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+		return true
+	}
+	if !p.nextTokenIs(token.LPAREN) {
+		return true
+	}
+
+	p.Next()
+	for {
+		if !p.expectNext(token.ID) {
+			return false
+		}
+		fn.ReturnTypes = append(fn.ReturnTypes, &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal})
+		if !p.nextTokenIs(token.COMMA) {
+			break
+		}
+		p.Next()
+	}
+	if !p.expectNext(token.RPAREN) {
+		return false
+	}
+
+	if len(fn.ReturnTypes) == 1 {
+		fn.ReturnType, fn.ReturnTypes = fn.ReturnTypes[0], nil
+	}
+	return true
+}
+
 func (p *Parser) parseFunctionArgs() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -413,7 +1502,9 @@ func (p *Parser) parseFunctionArgs() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.Next() // curTok => id
+	if !p.expectNext(token.ID) {
+		return nil
+	}
 	ident := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 	if !p.expectNext(token.ID) { // require type for arg
 		return nil
@@ -426,7 +1517,9 @@ func (p *Parser) parseFunctionArgs() []*ast.Identifier {
 	for p.nextTokenIs(token.COMMA) {
 
 		p.Next()
-		p.Next()
+		if !p.expectNext(token.ID) {
+			return nil
+		}
 		ident := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 		if !p.expectNext(token.ID) {
 			return nil
@@ -445,32 +1538,121 @@ func (p *Parser) parseFunctionArgs() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curTok, Function: function}
 	exp.Args = p.parseCallArguments()
+	exp.Rparen = p.curTok
 	return exp
 }
 
 func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+	return p.parseExpressionList(token.RPAREN)
+}
 
-	if p.nextTokenIs(token.RPAREN) {
+// parseExpressionList parses comma separated expressions up to the end
+// token, allowing a trailing comma: (1, 2) or [1, 2,]
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	noBrace := p.noBrace
+	p.noBrace = false
+	defer func() { p.noBrace = noBrace }()
+
+	if p.nextTokenIs(end) {
 		p.Next()
-		return args
+		return list
 	}
 
 	p.Next()
-	args = append(args, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 
 	for p.nextTokenIs(token.COMMA) {
 		p.Next()
+		if p.nextTokenIs(end) {
+			break
+		}
 		p.Next()
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectNext(token.RPAREN) {
+	if !p.expectNext(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curTok}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curTok
+	return array
+}
+
+// parseHashLiteral parses {key: value, ...}, keys and values can be any
+// expression and a trailing comma is allowed.
+func (p *Parser) parseHashLiteral() ast.Expression {
+	if p.noBrace {
+		p.noPrefixParseFnError(p.curTok.Type)
+		return nil
+	}
+
+	hash := &ast.HashLiteral{Token: p.curTok}
+
+	for !p.nextTokenIs(token.RBRACE) {
+		p.Next()
+		key := p.parseExpression(LOWEST)
+		if !p.expectNext(token.COLON) {
+			return nil
+		}
+
+		p.Next()
+		value := p.parseExpression(LOWEST)
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		if !p.nextTokenIs(token.RBRACE) && !p.expectNext(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.Next()
+	hash.Rbrace = p.curTok
+
+	return hash
+}
+
+// parseIndexExpression parses a[i] as well as the slices a[i:j], a[i:] and
+// a[:j].
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.curTok
+	p.Next()
+
+	noBrace := p.noBrace
+	p.noBrace = false
+	defer func() { p.noBrace = noBrace }()
+
+	var low ast.Expression
+	if !p.curTokenIs(token.COLON) {
+		low = p.parseExpression(LOWEST)
+		if !p.nextTokenIs(token.COLON) {
+			if !p.expectNext(token.RBRACKET) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: tok, Left: left, Index: low, Rbracket: p.curTok}
+		}
+		p.Next()
+	}
+
+	slice := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+	if !p.nextTokenIs(token.RBRACKET) {
+		p.Next()
+		slice.High = p.parseExpression(LOWEST)
+	}
+	if !p.expectNext(token.RBRACKET) {
 		return nil
 	}
+	slice.Rbracket = p.curTok
 
-	// fmt.Println(args)
-	return args
+	return slice
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -492,6 +1674,11 @@ func (p *Parser) expectNext(t token.TokenType) bool {
 }
 
 func (p *Parser) peekPowerBind() int {
+	// a [ starting a new line begins an array literal, not an index
+	if p.nextTokenIs(token.LBRACKET) && p.nextTok.Pos.Line > p.curTok.End.Line {
+		return LOWEST
+	}
+
 	if p, ok := powerBind[p.nextTok.Type]; ok {
 		return p
 	}
@@ -516,25 +1703,41 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixFN) {
 }
 
 var powerBind = map[token.TokenType]int{
+	token.OR:       LOGICOR,
+	token.AND:      LOGICAND,
 	token.EQ:       EQUALS,
 	token.NEQ:      EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LE:       LESSGREATER,
+	token.GE:       LESSGREATER,
+	token.IN:       LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
+	token.PIPE:     SUM,
+	token.CARET:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.MOD:      PRODUCT,
+	token.AMP:      PRODUCT,
+	token.AND_NOT:  PRODUCT,
+	token.SHL:      PRODUCT,
+	token.SHR:      PRODUCT,
 	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 const (
 	_ int = iota
 	LOWEST
+	LOGICOR     // ||
+	LOGICAND    // &&
 	EQUALS      // ==
-	LESSGREATER // > or <
-	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -X or !X
+	LESSGREATER // > or < or <= or >= or in
+	SUM         // + - | ^
+	PRODUCT     // * / % & &^ << >>
+	PREFIX      // -X or !X or ~X
 	CALL        // myFunction(X)
+	INDEX       // array[index] or p.x
 )
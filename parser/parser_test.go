@@ -47,6 +47,84 @@ func TestVarStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		names    []string
+		expected string
+	}{
+		{"const x = 5", []string{"x"}, "const x = 5;\n"},
+		{"const x int = 5;", []string{"x"}, "const x = 5;\n"},
+		{"const (\n  a = 1\n  b = a + 1; c = \"c\"\n)", []string{"a", "b", "c"}, "const (\n\ta = 1\n\tb = (a + 1)\n\tc = c\n);\n"},
+		{"const ()", nil, "const (\n);\n"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not contain 1 statement. got=%d", tt.input, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ConstStatement)
+		if !ok {
+			t.Fatalf("%q: stmt is not *ast.ConstStatement. got=%T", tt.input, program.Statements[0])
+		}
+		if len(stmt.Specs) != len(tt.names) {
+			t.Fatalf("%q: wrong number of specs. expected=%d, got=%d", tt.input, len(tt.names), len(stmt.Specs))
+		}
+		for i, spec := range stmt.Specs {
+			if spec.Name.Value != tt.names[i] || spec.Literal() != "const" {
+				t.Errorf("%q: wrong spec %d. got=%s %s", tt.input, i, spec.Literal(), spec.Name.Value)
+			}
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("%q: wrong String. expected=%q, got=%q", tt.input, tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestConstErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x", "1:8: expect next token to be =, got EOF instead"},
+		{"const = 1", "1:7: expect next token to be ID, got = instead"},
+		{"const (a = 1", "1:13: unclosed const group, expect ) before end of file"},
+		{"const (a = 1, b = 2)", "1:13: expect next token to be ID, got , instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestConstRecovery(t *testing.T) {
+	p := New(lexer.New("var a = * 1 const b = 2; b"))
+	program := p.Parse()
+
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != "1:9: expect an expression, got * instead" {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+	// the const and b survive
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d: %s",
+			len(program.Statements), program.String())
+	}
+	if _, ok := program.Statements[0].(*ast.ConstStatement); !ok {
+		t.Errorf("program.Statements[0] is not *ast.ConstStatement. got=%T", program.Statements[0])
+	}
+}
+
 func TestAssignStatements(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -86,6 +164,97 @@ func TestAssignStatements(t *testing.T) {
 		}
 	}
 }
+
+func TestMultipleValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var q, r = divmod(7, 2)", "var q, r = divmod(7, 2);\n"},
+		{"var a, b int = 1, 2 + 3", "var a, b = 1, (2 + 3);\n"},
+		{"a, b = b, a", "a, b = b, a;"},
+		{"a[0], p.x, c = f()", "(a[0]), p.x, c = f();"},
+		{"x = 1, 2", "x = 1, 2;"},
+		{"return a / b, a % b", "return (a / b), (a % b);"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("var a, b int = f()"))
+	program := p.Parse()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.VarStatement)
+	if stmt.Name != nil || len(stmt.Names) != 2 || stmt.Names[1].Type.Value != "int" {
+		t.Errorf("wrong names, got %+v", stmt.Names)
+	}
+
+	results := []struct {
+		input       string
+		returnType  string
+		returnTypes []string
+	}{
+		{"func divmod(a int, b int) (int, int) {}", "", []string{"int", "int"}},
+		{"func (p P) pair() (int, string) {}", "", []string{"int", "string"}},
+		{"func() (int) {}", "int", nil},
+		{"func() int {}", "int", nil},
+		{"func() {}", "", nil},
+	}
+
+	for _, tt := range results {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if tt.returnType != "" && (fn.ReturnType == nil || fn.ReturnType.Value != tt.returnType) {
+			t.Errorf("%q: wrong ReturnType, got %v", tt.input, fn.ReturnType)
+		}
+		if tt.returnType == "" && fn.ReturnType != nil {
+			t.Errorf("%q: unexpected ReturnType %s", tt.input, fn.ReturnType)
+		}
+		if len(fn.ReturnTypes) != len(tt.returnTypes) {
+			t.Fatalf("%q: wrong ReturnTypes, got %v", tt.input, fn.ReturnTypes)
+		}
+		for i, rt := range fn.ReturnTypes {
+			if rt.Value != tt.returnTypes[i] {
+				t.Errorf("%q: wrong ReturnTypes[%d], got %s", tt.input, i, rt.Value)
+			}
+		}
+	}
+}
+
+func TestMultipleValuesErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a, 1 = 1, 2", "1:6: cannot assign to 1"},
+		{"a, b += 1", "1:6: expect next token to be =, got += instead"},
+		{"a, b", "1:5: expect next token to be =, got EOF instead"},
+		{"var a, = 1", "1:8: expect next token to be ID, got = instead"},
+		{"func f() (int, ) {}", "1:16: expect next token to be ID, got ) instead"},
+		{"func f() (int {}", "1:15: expect next token to be ), got { instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	input := `
 	return 5;
@@ -148,6 +317,118 @@ func TestForStatements(t *testing.T) {
 	}
 }
 
+func TestBranchStatements(t *testing.T) {
+	input := `
+	outer: for x < 3 {
+		for {
+			break
+			continue outer
+		}
+	}
+	`
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	forStmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ForStatement. got=%T", program.Statements[0])
+	}
+	if forStmt.Label == nil || forStmt.Label.Value != "outer" {
+		t.Fatalf("forStmt.Label not 'outer'. got=%v", forStmt.Label)
+	}
+
+	inner := forStmt.Body.Statements[0].(*ast.ForStatement)
+	if _, ok := inner.Body.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("stmt not *ast.BreakStatement. got=%T", inner.Body.Statements[0])
+	}
+	cont, ok := inner.Body.Statements[1].(*ast.ContinueStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ContinueStatement. got=%T", inner.Body.Statements[1])
+	}
+	if cont.Label.Value != "outer" {
+		t.Errorf("cont.Label not 'outer'. got=%s", cont.Label.Value)
+	}
+}
+
+func TestRangeStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for i, v in a { v }", "for i, v in a "},
+		{"for v in [1, 2] {}", "for v in [1, 2] "},
+		{"for _, v in f(x) + y {}", "for _, v in (f(x) + y) "},
+		{"outer: for k in h { break outer }", "outer: for k in h "},
+		{"for x in h == ({}) {}", "for x in (h == {}) "},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("for k, v in h { continue }"))
+	program := p.Parse()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ForStatement)
+	if stmt.Key.Value != "k" || stmt.Value.Value != "v" || stmt.Range.String() != "h" {
+		t.Errorf("wrong range clause, got %q", stmt.String())
+	}
+	if _, ok := stmt.Body.Statements[0].(*ast.ContinueStatement); !ok {
+		t.Errorf("stmt not *ast.ContinueStatement. got=%T", stmt.Body.Statements[0])
+	}
+
+	for input, expected := range map[string]string{
+		"for i, in a {}":   "1:8: expect next token to be ID, got IN instead",
+		"for i, v a {}":    "1:10: expect next token to be IN, got ID instead",
+		"for i, v in a }":  "1:15: expect next token to be {, got } instead",
+		"for i, v, w in a": "1:9: expect next token to be IN, got , instead",
+	} {
+		p := New(lexer.New(input))
+		p.Parse()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", input, expected, errors)
+		}
+	}
+}
+
+func TestBranchStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break", "1:1: break is not in a loop"},
+		{"if x { continue }", "1:8: continue is not in a loop"},
+		{"for { func() { break } }", "1:16: break is not in a loop"},
+		{"for { break inner }", "1:13: break label not defined: inner"},
+		{"a: for { a: for {} }", "1:10: label a already defined"},
+		{"a: x", "1:4: label a must be followed by a for loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error for %q, got %d: %q", tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
@@ -179,6 +460,102 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xff", 255},
+		{"0XFF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_7fff_ffff_ffff_ffff", 9223372036854775807},
+		{"0b_1", 1},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("%q: literal.Value not %d. got=%d", tt.input, tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestNumberLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var big = 9223372036854775808", "1:11: integer literal 9223372036854775808 overflows int"},
+		{"x + 0x1_0000_0000_0000_0000", "1:5: integer literal 0x1_0000_0000_0000_0000 overflows int"},
+		{"var a = 0b102", "1:9: invalid integer literal 0b102"},
+		{"var a = 0xfg", "1:9: invalid integer literal 0xfg"},
+		{"var a = 0x", "1:9: invalid integer literal 0x"},
+		{"var a = 1__0", "1:9: invalid integer literal 1__0"},
+		{"var a = 1_", "1:9: invalid integer literal 1_"},
+		{"var a = 1_.5", "1:9: invalid float literal 1_.5"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got %d: %q", tt.input, len(errors), errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+
+	p := New(lexer.New("99999999999999999999"))
+	p.Parse()
+	if hint := p.Diagnostics()[0].Hint; hint == "" {
+		t.Errorf("expected a hint on integer overflow")
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"0.25", 0.25},
+		{"1e-3", 0.001},
+		{"2.5E+2", 250},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+		if literal.Literal() != tt.input {
+			t.Errorf("literal.TokenLiteral not %s. got=%s", tt.input, literal.Literal())
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -282,6 +659,34 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a | b & c",
+			"(a | (b & c))",
+		},
+		{
+			"a ^ b << 2 + c",
+			"((a ^ (b << 2)) + c)",
+		},
+		{
+			"a &^ b >> c == d & ~e",
+			"(((a &^ b) >> c) == (d & (~e)))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a < b == c >= d && !e",
+			"(((a < b) == (c >= d)) && (!e))",
+		},
+		{
+			"a + 1 <= b * 2 || c",
+			"(((a + 1) <= (b * 2)) || c)",
+		},
 		{
 			"-a - b * -5",
 			"((-a) - (b * (-5)))",
@@ -369,6 +774,20 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{"a = a + 2", "a = (a + 2);"},
 		{"a = 13 % 6", "a = (13 % 6);"},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{"a[1:2][0]", "((a[1:2])[0])"},
+		{"a[:-1]", "(a[:(-1)])"},
+		{"a[i] = a[i - 1] + 1", "(a[i]) = ((a[(i - 1)]) + 1);"},
+		{"a\n[1]", "a[1]"},
+		{"a in b == c in d", "((a in b) == (c in d))"},
+		{"1 + 2 in a", "((1 + 2) in a)"},
 	}
 
 	for _, tt := range tests {
@@ -731,6 +1150,538 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestNodePositions(t *testing.T) {
+	input := `var x = add(1, 2)
+if x > 2 {
+  x
+}`
+
+	l := lexer.NewFile("pos.dao", input)
+	p := New(l)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node       ast.Node
+		start, end string
+	}{
+		{program, "pos.dao:1:1", "pos.dao:4:2"},
+		{program.Statements[0], "pos.dao:1:1", "pos.dao:1:18"},
+		{program.Statements[0].(*ast.VarStatement).Value, "pos.dao:1:9", "pos.dao:1:18"},
+		{program.Statements[1], "pos.dao:2:1", "pos.dao:4:2"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression).Condition, "pos.dao:2:4", "pos.dao:2:9"},
+	}
+
+	for i, tt := range tests {
+		if got := tt.node.Pos().String(); got != tt.start {
+			t.Errorf("tests[%d] - Pos() wrong. expected=%q, got=%q", i, tt.start, got)
+		}
+		if got := tt.node.End().String(); got != tt.end {
+			t.Errorf("tests[%d] - End() wrong. expected=%q, got=%q", i, tt.end, got)
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	input := "var x = 1\nvar = 2"
+
+	l := lexer.NewFile("err.dao", input)
+	p := New(l)
+	p.Parse()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "err.dao:2:5: expect next token to be ID, got = instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	input := `var a = 1
+var = 2
+var b = (3 + )
+func f(x int) {
+    var y = * 2
+    y
+}
+if a > { 1 }
+var c = a; c + ; var d = 4
+d
+}
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+
+	expected := []string{
+		"2:5: expect next token to be ID, got = instead",
+		"3:14: expect an expression, got ) instead",
+		"5:13: expect an expression, got * instead",
+		"8:8: expect an expression, got { instead",
+		"9:16: expect an expression, got ; instead",
+		"11:1: expect an expression, got } instead",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d: %q", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i])
+		}
+	}
+
+	// a, f, c, d and the trailing d survive
+	if len(program.Statements) != 5 {
+		t.Fatalf("program.Statements does not contain 5 statements. got=%d: %s",
+			len(program.Statements), program.String())
+	}
+
+	fn := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 1 {
+		t.Errorf("function body should keep 1 statement. got=%d", len(fn.Body.Statements))
+	}
+}
+
+func TestRecoveryInsideBraces(t *testing.T) {
+	tests := []struct {
+		input      string
+		expected   []string
+		statements int
+	}{
+		{`var h = {"a" 1}; h`, []string{"1:14: expect next token to be :, got INT instead"}, 1},
+		{`P{x 1}; 2`, []string{"1:5: expect next token to be :, got INT instead"}, 1},
+		{`match 1 { 1 => 2, 3 4 }; 5`, []string{"1:21: expect next token to be =>, got INT instead"}, 1},
+		{`enum E { A(, B }; var e = 1`, []string{"1:12: expect next token to be ID, got , instead"}, 1},
+		{`func f() { var h = {"a" 1}; h }
+var z = * 3`, []string{
+			"1:25: expect next token to be :, got INT instead",
+			"2:9: expect an expression, got * instead",
+		}, 1},
+		{`func f() { g(1 2 }
+var z = * 3; 4`, []string{
+			"1:16: expect next token to be ), got INT instead",
+			"2:9: expect an expression, got * instead",
+		}, 2},
+		{`func f(a int, ) {}`, []string{"1:15: expect next token to be ID, got ) instead"}, 0},
+		{`func f(1 int) {}`, []string{"1:8: expect next token to be ID, got INT instead"}, 0},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: expected %d errors, got %d: %q", tt.input, len(tt.expected), len(errors), errors)
+			continue
+		}
+		for i, err := range errors {
+			if err != tt.expected[i] {
+				t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected[i], err)
+			}
+		}
+		if len(program.Statements) != tt.statements {
+			t.Errorf("%q: expected %d statements, got %d: %s", tt.input, tt.statements, len(program.Statements), program.String())
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"var a = 1 /* open", []string{"1:11: unterminated block comment"}},
+		{"var a = @\nvar b = 2 # 1", []string{"1:9: illegal character '@'", "2:11: illegal character '#'"}},
+		{"var a = // note\n  1 + /* two */ 2", nil},
+		{"var s = \"abc\nvar t = 1", []string{"1:9: unterminated string literal"}},
+		{"var s = \"a\\zb\"; var t = `x", []string{"1:11: unknown escape sequence \\z", "1:25: unterminated raw string literal"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Fatalf("%q: expected %d errors, got %d: %q", tt.input, len(tt.expected), len(errors), errors)
+		}
+		for i, err := range errors {
+			if err != tt.expected[i] {
+				t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected[i], err)
+			}
+		}
+	}
+}
+
+func TestUnclosedBlock(t *testing.T) {
+	l := lexer.New("if x {\n  y\n")
+	p := New(l)
+	p.Parse()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got %d: %q", len(errors), errors)
+	}
+
+	expected := "1:6: unclosed block, expect } before end of file"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestArrayLiteralParsing(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3,\n]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 1, "two": 2, "three": 3}`, `{one: 1, two: 2, three: 3}`},
+		{`{}`, `{}`},
+		{"{1: true, a: 0 + 1,\n\"b\": [1],\n}", `{1: true, a: (0 + 1), b: [1]}`},
+		{`var h = {"a": {"b": 1}}`, `var h = {a: {b: 1}};` + "\n"},
+		{`if x == ({}) { {} }`, `if(x == {}) {}`},
+		{`for len({1: 2}) > 1 { }`, `for(len({1: 2}) > 1) `},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestHashLiteralInHeader(t *testing.T) {
+	l := lexer.New("if x == {} { 1 }")
+	p := New(l)
+	p.Parse()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got %d: %q", len(errors), errors)
+	}
+	expected := "1:9: expect an expression, got { instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestSliceExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input     string
+		low, high interface{}
+	}{
+		{"a[1:2]", 1, 2},
+		{"a[1:]", 1, nil},
+		{"a[:2]", nil, 2},
+		{"a[:]", nil, nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		slice, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		for _, bound := range []struct {
+			exp      ast.Expression
+			expected interface{}
+		}{{slice.Low, tt.low}, {slice.High, tt.high}} {
+			if bound.expected == nil {
+				if bound.exp != nil {
+					t.Errorf("bound of %q should be empty. got=%s", tt.input, bound.exp)
+				}
+				continue
+			}
+			testLiteralExpression(t, bound.exp, bound.expected)
+		}
+	}
+}
+
+func TestCompoundAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a += 1", "a += 1;"},
+		{"a -= b * 2", "a -= (b * 2);"},
+		{"a *= 2; a /= 2; a %= 2", "a *= 2;a /= 2;a %= 2;"},
+		{"a[0] += 1", "(a[0]) += 1;"},
+		{"i++", "i++;"},
+		{"i--; a[i]++", "i--;(a[i])++;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestAssignTargetErrors(t *testing.T) {
+	l := lexer.New("a + b = 1\na[1:] = 2\nf() += 1\n(a + 1)++")
+	p := New(l)
+	p.Parse()
+
+	expected := []string{"1:7: cannot assign to (a + b)", "2:7: cannot assign to (a[1:])", "3:5: cannot assign to f()", "4:8: cannot ++ (a + 1)"}
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %q", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i])
+		}
+	}
+}
+
+func TestStructParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"type Point struct { x int; y int }", "type Point struct { x int; y int };"},
+		{"type P struct {\n\tx int\n\tnext P\n}", "type P struct { x int; next P };"},
+		{"type E struct {}", "type E struct {  };"},
+		{"Point{x: 1, y: 2 + 3,}", "Point{x: 1, y: (2 + 3)}"},
+		{"Point{}", "Point{}"},
+		{"p.x", "p.x"},
+		{"p.a.b[0].c", "(p.a.b[0]).c"},
+		{"-p.x * 2", "((-p.x) * 2)"},
+		{"p.norm(1).y", "p.norm(1).y"},
+		{"p.x = 1; p.x += 2; p.x++", "p.x = 1;p.x += 2;p.x++;"},
+		{"if p == Point {}", "if(p == Point) "},
+		{"func (p Point) norm(s int) int { p.x }", "func (p Point) norm(s) p.x"},
+		{"func(x int) int { x }", "func(x) x"},
+		{"type S interface { area() int; scale(f int, g float) }", "type S interface { area() int; scale(f int, g float) };"},
+		{"type E interface {}", "type E interface {  };"},
+		{"s.(Circle).r", "s.(Circle).r"},
+		{"s.(int) + 1", "(s.(int) + 1)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestMethodParsing(t *testing.T) {
+	p := New(lexer.New("func (p Point) move(dx int) Point { p }"))
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if fn.Receiver == nil || fn.Receiver.Value != "p" || fn.Receiver.Type.Value != "Point" {
+		t.Fatalf("wrong receiver. got=%+v", fn.Receiver)
+	}
+	if fn.Name.Value != "move" || len(fn.Args) != 1 || fn.Args[0].Value != "dx" {
+		t.Errorf("wrong name or args. got=%s %v", fn.Name, fn.Args)
+	}
+	if fn.ReturnType == nil || fn.ReturnType.Value != "Point" {
+		t.Errorf("wrong return type. got=%v", fn.ReturnType)
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"type P struct { x int; x int }", "1:24: duplicate field x"},
+		{"type P struct { x }", "1:19: expect next token to be ID, got } instead"},
+		{"type P int", "1:8: expect struct or interface after type P, got ID instead"},
+		{"P{x: 1, x: 2}", "1:9: duplicate field x in struct literal"},
+		{"P{1}", "1:3: expect next token to be ID, got INT instead"},
+		{"p.1", "1:3: expect next token to be ID, got INT instead"},
+		{"func (a int, b int) f() {}", "1:21: method f must have exactly one receiver"},
+		{"p.f() = 1", "1:7: cannot assign to p.f()"},
+		{"type S interface { f(); f() }", "1:25: duplicate method f"},
+		{"type S interface { f }", "1:22: expect next token to be (, got } instead"},
+		{"s.(1)", "1:4: expect next token to be ID, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestEnumAndMatchParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Result { Ok(v), Err(msg) }", "enum Result { Ok(v), Err(msg) };"},
+		{"enum Color {\n\tRed\n\tGreen; Blue,\n}", "enum Color { Red, Green, Blue };"},
+		{"enum P { At(x, y) }", "enum P { At(x, y) };"},
+		{"match r { Ok(v) => v + 1, Err(e) => { e } }", "match r { Ok(v) => (v + 1), Err(e) => e }"},
+		{"match x {\n\t1 => \"one\",\n\t-2.5 => \"neg\",\n\t_ => nil\n}", "match x { 1 => one, (-2.5) => neg, _ => nil }"},
+		{"match a { [] => 0, [x, ..rest] => x, [..] => 1 }", "match a { [] => 0, [x, ..rest] => x, [..] => 1 }"},
+		{"match a { At([1, _], y) => y }", "match a { At([1, _], y) => y }"},
+		{"var n = match c { Red => 1, _ => 2 } + 1", "var n = (match c { Red => 1, _ => 2 } + 1);\n"},
+		{"if match c { Red => true } { 1 }", "ifmatch c { Red => true } 1"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestEnumAndMatchErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum C { Red, Red }", "1:15: duplicate variant Red"},
+		{"enum C { Ok() }", "1:13: expect next token to be ID, got ) instead"},
+		{"enum { A }", "1:6: expect next token to be ID, got { instead"},
+		{"match x { 1 2 }", "1:13: expect next token to be =>, got INT instead"},
+		{"match x { 1 => 1 2 => 2 }", "1:18: expect next token to be ,, got INT instead"},
+		{"match x { a + 1 => 1 }", "1:13: expect next token to be =>, got + instead"},
+		{"match x { (a) => 1 }", "1:11: expect a pattern, got ( instead"},
+		{"match x { [..r, y] => 1 }", "1:15: ..r must be the last pattern of an array"},
+		{"match x { -a => 1 }", "1:12: expect a number after - in a pattern, got ID instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestSwitchParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"switch x { case 1, 2: a; case 3: b\ndefault: c }", "switch x { case 1, 2: a case 3: b default: c }"},
+		{"switch {\ncase x < 1:\n\ta\n\tfallthrough\ncase x > 2:\n}", "switch { case (x < 1): afallthrough; case (x > 2):  }"},
+		{"switch f(x) + 1 {}", "switch (f(x) + 1) { }"},
+		{"switch h == ({}) { default: }", "switch (h == {}) { default:  }"},
+		{"for { switch x { case 1: break; case 2: continue } }", "for "},
+		{"switch x { case 1: switch y { default: break } }", "switch x { case 1: switch y { default: break; } }"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("switch x { case 1: fallthrough; case 2: }"))
+	program := p.Parse()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.SwitchStatement)
+	if !stmt.Cases[0].Fallthrough() || stmt.Cases[1].Fallthrough() {
+		t.Errorf("wrong fallthrough, got %q", stmt.String())
+	}
+}
+
+func TestSwitchErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"switch x { a }", "1:12: expect case or default, got ID instead"},
+		{"switch x { case 1 a }", "1:19: expect next token to be :, got ID instead"},
+		{"switch x { default: a; default: b }", "1:24: multiple defaults in switch"},
+		{"switch x { case 1: fallthrough }", "1:20: cannot fallthrough final case in switch"},
+		{"switch x { case 1: fallthrough; a; case 2: }", "1:20: fallthrough statement out of place"},
+		{"switch x { case 1: if y { fallthrough } case 2: }", "1:27: fallthrough statement out of place"},
+		{"fallthrough", "1:1: fallthrough statement out of place"},
+		{"case 1: a", "1:1: case is not in a switch"},
+		{"switch x { case 1: continue }", "1:20: continue is not in a loop"},
+		{"switch x { case 1: func() { break } }", "1:29: break is not in a loop"},
+		{"switch x { case 1: a", "1:10: unclosed switch, expect } before end of file"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+
+	// the clauses after an error are still parsed
+	p := New(lexer.New("switch x { case 1 a; case 2: var }"))
+	p.Parse()
+	if errors := p.Errors(); len(errors) != 2 {
+		t.Errorf("expected 2 errors, got %q", errors)
+	}
+}
+
 func testVarStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.Literal() != "var" {
 		t.Errorf("s.Literal not 'var'. got=%q", s.Literal())
@@ -2,21 +2,32 @@ package repl
 
 import (
 	"bufio"
+	"dao/ast"
+	"dao/diag"
 	"dao/eval"
 	"dao/lexer"
 	"dao/meta"
 	"dao/parser"
+	"dao/resolver"
+	"dao/types"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 const PROMPT = "|☰☷☳☶☱☴☵☲|"
 
+// Run reads and runs the lines of a session. Each input is a line of the
+// session source, so that an error in a function defined by an earlier
+// line is shown under that line.
 func Run(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	e := meta.NewEnv()
+	r := resolver.New()
+	checker := types.NewChecker()
+	var session []string
 
 	for {
 		fmt.Fprint(out, PROMPT)
@@ -26,55 +37,138 @@ func Run(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
-		l := lexer.New(line)
+		typeOf := strings.HasPrefix(line, ":type")
+		if typeOf {
+			line = strings.TrimSpace(strings.TrimPrefix(line, ":type"))
+		}
+		session = append(session, line)
+		l := lexer.NewAt("", line, len(session))
+		printer := diag.NewPrinter(out, strings.Join(session, "\n"))
+		if typeOf {
+			printType(out, printer, r, checker, l)
+			continue
+		}
+
 		p := parser.New(l)
 		program := p.Parse()
 
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printer.PrintAll(p.Diagnostics())
+			continue
+		}
+		if !checkLine(printer, r, checker, program) {
 			continue
 		}
 
 		res := eval.Eval(program, e)
-		if res != nil {
-			io.WriteString(out, res.Echo())
-			io.WriteString(out, "\n")
+		printResult(out, printer, res)
+	}
+}
+
+// printType prints the inferred type of the expression read by l, without
+// running it.
+func printType(out io.Writer, printer *diag.Printer, r *resolver.Resolver, checker *types.Checker, l *lexer.Lexer) {
+	p := parser.New(l)
+	program := p.Parse()
+
+	if len(p.Errors()) != 0 {
+		printer.PrintAll(p.Diagnostics())
+		return
+	}
+
+	if len(program.Statements) != 1 {
+		fmt.Fprintln(out, "usage: :type <expression>")
+		return
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		fmt.Fprintln(out, "usage: :type <expression>")
+		return
+	}
+
+	if checkLine(printer, r, checker, program) {
+		fmt.Fprintln(out, checker.TypeOf(stmt.Expression))
+	}
+}
+
+// checkLine resolves and type checks a line of the repl, keeping what it
+// declares for the next lines. It reports whether the line is free of
+// errors.
+func checkLine(printer *diag.Printer, r *resolver.Resolver, checker *types.Checker, program *ast.Program) bool {
+	diags := append(r.Resolve(program), checker.Check(program)...)
+	printer.PrintAll(diags)
+	for _, d := range diags {
+		if d.Severity == diag.Error {
+			return false
 		}
 	}
+	return true
 }
 
-func Eat(path string) {
+// Eat runs a source file once it parses, resolves and type checks, it
+// reports false when the file doesn't get to run or its run ends with an
+// error.
+func Eat(path string) bool {
+	program, printer, ok := load(path)
+	if !ok {
+		return false
+	}
+
+	e := meta.NewEnv()
+	res := eval.Eval(program, e)
+	printResult(os.Stdout, printer, res)
+	_, failed := res.(*meta.Error)
+	return !failed
+}
+
+// Check parses and type checks a source file without running it, it
+// reports whether the file is free of errors.
+func Check(path string) bool {
+	_, _, ok := load(path)
+	return ok
+}
+
+// load reads, parses, resolves and checks the file at path, printing the
+// diagnostics to stderr. ok is false when there are errors.
+func load(path string) (program *ast.Program, printer *diag.Printer, ok bool) {
 	f, err := os.Open(path)
 	if err != nil {
 		fmt.Println("can not open file ", path)
-		defer f.Close()
-		return
+		return nil, nil, false
 	}
+	defer f.Close()
 
 	in, err := ioutil.ReadAll(f)
 	if err != nil {
 		fmt.Println("read file failed!")
-		return
+		return nil, nil, false
 	}
 
-	l := lexer.New(string(in))
+	l := lexer.NewFile(path, string(in))
 	p := parser.New(l)
-	program := p.Parse()
-	e := meta.NewEnv()
+	program = p.Parse()
 
+	printer = diag.NewPrinter(os.Stderr, string(in))
 	if len(p.Errors()) != 0 {
-		printParserErrors(os.Stdout, p.Errors())
+		printer.PrintAll(p.Diagnostics())
+		return nil, printer, false
 	}
 
-	res := eval.Eval(program, e)
-	if res != nil {
-		io.WriteString(os.Stdout, res.Echo())
-		io.WriteString(os.Stdout, "\n")
+	if !checkLine(printer, resolver.New(), types.NewChecker(), program) {
+		return nil, printer, false
 	}
+
+	return program, printer, true
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printResult(out io.Writer, printer *diag.Printer, res meta.Meta) {
+	if err, ok := res.(*meta.Error); ok {
+		printer.Print(err.Diagnostic())
+		return
+	}
+
+	if res != nil {
+		io.WriteString(out, res.Echo())
+		io.WriteString(out, "\n")
 	}
 }
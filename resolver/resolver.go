@@ -0,0 +1,443 @@
+// Package resolver binds the names used in a program to their declarations
+// before it runs. Every function, every block of an if, for, switch or match
+// and every arm of a match opens a scope; a var is only visible in its scope,
+// after its declaration.
+package resolver
+
+import (
+	"dao/ast"
+	"dao/diag"
+	"dao/token"
+	"fmt"
+)
+
+// decl is a name declared in a scope.
+type decl struct {
+	Pos      token.Position
+	Variant  bool // 枚举的变体, 在模式中不是绑定
+	Const    bool
+	Type     bool // 类型或枚举的名字
+	Declared bool // 已被声明; 预先登记的全局名字在其声明语句之前为 false
+	Earlier  bool // 由之前的 Resolve 声明的全局名字, REPL 的新输入可以重新声明
+}
+
+type scope struct {
+	names map[string]*decl
+	fn    bool // the scope of the parameters and the body of a function
+	outer *scope
+}
+
+func newScope(outer *scope, fn bool) *scope {
+	return &scope{names: make(map[string]*decl), fn: fn, outer: outer}
+}
+
+// Resolver sets the Binding of the identifiers it resolves. The names of
+// the global scope are declared ahead of the statements, a function may use
+// a global declared after it. In other scopes, only the named functions and
+// the types are. The builtins are declared nowhere, they are left unbound.
+type Resolver struct {
+	global *scope
+	scope  *scope
+	diags  []*diag.Diagnostic
+}
+
+func New() *Resolver {
+	global := newScope(nil, false)
+	return &Resolver{global: global, scope: global}
+}
+
+// Resolve resolves a whole program.
+func Resolve(program *ast.Program) []*diag.Diagnostic {
+	return New().Resolve(program)
+}
+
+// Resolve resolves program and returns its diagnostics. The globals it
+// declares stay in scope for the next call, as in a REPL session.
+func (r *Resolver) Resolve(program *ast.Program) []*diag.Diagnostic {
+	r.diags = nil
+	for _, d := range r.global.names {
+		d.Earlier = d.Declared
+	}
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.VarStatement:
+			for _, name := range s.Idents() {
+				r.declareGlobal(name, false)
+			}
+		case *ast.ConstStatement:
+			for _, spec := range s.Specs {
+				r.declareGlobal(spec.Name, true)
+			}
+		}
+	}
+	r.hoist(program.Statements)
+	for _, stmt := range program.Statements {
+		r.stmt(stmt)
+	}
+	return r.diags
+}
+
+func (r *Resolver) report(n ast.Node, severity diag.Severity, code string, format string, a ...interface{}) *diag.Diagnostic {
+	d := &diag.Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Msg:      fmt.Sprintf(format, a...),
+		Pos:      n.Pos(),
+		End:      n.End(),
+	}
+	r.diags = append(r.diags, d)
+	return d
+}
+
+// declareGlobal registers a global of a var or const statement ahead of
+// the statements; the statement itself declares it.
+func (r *Resolver) declareGlobal(name *ast.Identifier, isConst bool) {
+	if _, ok := r.global.names[name.Value]; ok {
+		return
+	}
+	r.global.names[name.Value] = &decl{Pos: name.Pos(), Const: isConst}
+}
+
+// declare declares name in the current scope, with a warning when it hides
+// a declaration of the enclosing blocks of the same function. Declaring a
+// name twice in a scope is an error, but for a global of an earlier call of
+// Resolve that isn't a constant: a REPL line may define it again.
+func (r *Resolver) declare(name *ast.Identifier) *decl {
+	d, ok := r.scope.names[name.Value]
+	switch {
+	case ok && d.Declared && d.Earlier && !d.Const:
+		d.Pos, d.Earlier, d.Type = name.Pos(), false, false
+	case ok && d.Declared:
+		e := r.report(name, diag.Error, diag.Redeclared, "%s redeclared in this block", name.Value)
+		e.Hint = fmt.Sprintf("%s is declared at line %d", name.Value, d.Pos.Line)
+		return d
+	case !ok:
+		if shadowed := r.shadowed(name.Value); shadowed != nil {
+			r.report(name, diag.Warning, diag.ShadowedName, "declaration of %s shadows the declaration at line %d", name.Value, shadowed.Pos.Line)
+		}
+		d = &decl{Pos: name.Pos()}
+		r.scope.names[name.Value] = d
+	}
+	d.Declared = true
+	return d
+}
+
+// shadowed returns the declaration of name in the scopes between the
+// current one and the scope of the function it belongs to, or the global
+// scope for the blocks of the top level; nil if there is none. A function
+// may shadow the globals and the names of the functions around it.
+func (r *Resolver) shadowed(name string) *decl {
+	for s := r.scope; !s.fn && s.outer != nil; s = s.outer {
+		if d, ok := s.outer.names[name]; ok && d.Declared {
+			return d
+		}
+	}
+	return nil
+}
+
+// lookup returns the binding of name, nil when it is not declared.
+func (r *Resolver) lookup(name string) (*ast.Binding, *decl) {
+	depth := 0
+	for s := r.scope; s != nil; s = s.outer {
+		if d, ok := s.names[name]; ok {
+			if s == r.global {
+				depth = -1
+			}
+			return &ast.Binding{Depth: depth}, d
+		}
+		depth++
+	}
+	return nil, nil
+}
+
+// early reports whether d is a global used at the top level above the
+// statement that declares it, when it doesn't exist yet. A function may use
+// it: the function runs later.
+func (r *Resolver) early(d *decl) bool {
+	if d.Declared {
+		return false
+	}
+	for s := r.scope; s != nil; s = s.outer {
+		if s.fn {
+			return false
+		}
+	}
+	return true
+}
+
+// hoist declares the named functions and the types of a list of
+// statements, and the variants of its enums.
+func (r *Resolver) hoist(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.ExpressionStatement:
+			if fn, ok := s.Expression.(*ast.FunctionLiteral); ok && fn.Name != nil && fn.Receiver == nil {
+				r.declare(fn.Name)
+			}
+		case *ast.TypeStatement:
+			r.declare(s.Name).Type = true
+		case *ast.EnumStatement:
+			r.declare(s.Name).Type = true
+			for _, v := range s.Variants {
+				r.declare(v.Name).Variant = true
+			}
+		}
+	}
+}
+
+func (r *Resolver) open(fn bool) {
+	r.scope = newScope(r.scope, fn)
+}
+
+func (r *Resolver) close() {
+	r.scope = r.scope.outer
+}
+
+// block resolves the statements of b in the current scope.
+func (r *Resolver) block(b *ast.BlockStatement) {
+	if b == nil {
+		return
+	}
+	r.hoist(b.Statements)
+	for _, stmt := range b.Statements {
+		r.stmt(stmt)
+	}
+}
+
+// scoped resolves b in a scope of its own.
+func (r *Resolver) scoped(b *ast.BlockStatement) {
+	r.open(false)
+	r.block(b)
+	r.close()
+}
+
+func (r *Resolver) stmt(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		r.expr(s.Expression)
+	case *ast.VarStatement:
+		// the var is in scope after its declaration: var x = x + 1 uses
+		// the x of an enclosing scope.
+		r.expr(s.Value)
+		for _, name := range s.Idents() {
+			r.declare(name)
+		}
+	case *ast.ConstStatement:
+		for _, spec := range s.Specs {
+			r.expr(spec.Value)
+			r.declare(spec.Name).Const = true
+		}
+	case *ast.AssignStatement:
+		r.expr(s.Value)
+		for _, target := range s.Targets {
+			if name, ok := target.(*ast.Identifier); ok {
+				r.assign(name)
+			} else {
+				r.expr(target)
+			}
+		}
+		switch {
+		case s.Target != nil:
+			r.expr(s.Target)
+		case s.Name != nil:
+			r.assign(s.Name)
+		}
+	case *ast.IncDecStatement:
+		if name, ok := s.Target.(*ast.Identifier); ok {
+			r.assign(name)
+			return
+		}
+		r.expr(s.Target)
+	case *ast.ReturnStatement:
+		r.expr(s.ReturnValue)
+	case *ast.ForStatement:
+		r.forStatement(s)
+	case *ast.SwitchStatement:
+		r.expr(s.Tag)
+		for _, clause := range s.Cases {
+			for _, v := range clause.Values {
+				r.expr(v)
+			}
+			r.scoped(clause.Body)
+		}
+	case *ast.BlockStatement:
+		r.block(s)
+	}
+}
+
+// assign resolves the name assigned to, which must have been declared and
+// not as a constant or a type.
+func (r *Resolver) assign(name *ast.Identifier) {
+	binding, d := r.lookup(name.Value)
+	if binding == nil || d.Variant {
+		e := r.report(name, diag.Error, diag.UndeclaredName, "cannot assign to undeclared name %s", name.Value)
+		e.Hint = fmt.Sprintf("declare it first: var %s = ...", name.Value)
+		return
+	}
+	if r.early(d) {
+		e := r.report(name, diag.Error, diag.UndeclaredName, "cannot assign to %s before its declaration", name.Value)
+		e.Hint = fmt.Sprintf("%s is declared at line %d", name.Value, d.Pos.Line)
+		return
+	}
+	if d.Const {
+		e := r.report(name, diag.Error, diag.AssignToConst, "cannot assign to constant %s", name.Value)
+		e.Hint = fmt.Sprintf("%s is declared with const at line %d", name.Value, d.Pos.Line)
+		return
+	}
+	if d.Type {
+		e := r.report(name, diag.Error, diag.AssignToType, "cannot assign to type %s", name.Value)
+		e.Hint = fmt.Sprintf("%s is declared as a type at line %d", name.Value, d.Pos.Line)
+		return
+	}
+	name.Binding = binding
+}
+
+// forStatement resolves a loop. The vars of the for clauses are in a scope
+// of their own, around the scope of the body; the vars of a range loop are
+// in the scope of the body.
+func (r *Resolver) forStatement(s *ast.ForStatement) {
+	if s.Range != nil {
+		r.expr(s.Range)
+		r.open(false)
+		for _, v := range []*ast.Identifier{s.Key, s.Value} {
+			if v != nil && v.Value != "_" {
+				r.declare(v)
+			}
+		}
+		r.block(s.Body)
+		r.close()
+		return
+	}
+
+	r.open(false)
+	for _, clause := range s.Condition {
+		r.stmt(clause)
+	}
+	r.scoped(s.Body)
+	r.close()
+}
+
+func (r *Resolver) expr(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		binding, d := r.lookup(e.Value)
+		switch {
+		case binding == nil && !token.Builtins[e.Value]:
+			r.report(e, diag.Error, diag.UndeclaredName, "undeclared name %s", e.Value)
+		case binding != nil && r.early(d):
+			err := r.report(e, diag.Error, diag.UndeclaredName, "%s used before its declaration", e.Value)
+			err.Hint = fmt.Sprintf("%s is declared at line %d", e.Value, d.Pos.Line)
+		}
+		e.Binding = binding
+	case *ast.PrefixExpression:
+		r.expr(e.Right)
+	case *ast.InfixExpression:
+		r.expr(e.Left)
+		r.expr(e.Right)
+	case *ast.IfExpression:
+		r.expr(e.Condition)
+		r.scoped(e.Consequence)
+		for _, option := range e.Options {
+			r.expr(option.Condition)
+			r.scoped(option.Consequence)
+		}
+		if e.Alternative != nil {
+			r.scoped(e.Alternative)
+		}
+	case *ast.MatchExpression:
+		r.expr(e.Subject)
+		for _, arm := range e.Arms {
+			r.open(false)
+			r.pattern(arm.Pattern)
+			r.block(arm.Body)
+			r.close()
+		}
+	case *ast.FunctionLiteral:
+		r.function(e)
+	case *ast.CallExpression:
+		r.expr(e.Function)
+		for _, arg := range e.Args {
+			r.expr(arg)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			r.expr(el)
+		}
+	case *ast.TupleLiteral:
+		for _, el := range e.Elements {
+			r.expr(el)
+		}
+	case *ast.HashLiteral:
+		for i, key := range e.Keys {
+			r.expr(key)
+			r.expr(e.Values[i])
+		}
+	case *ast.IndexExpression:
+		r.expr(e.Left)
+		r.expr(e.Index)
+	case *ast.SliceExpression:
+		r.expr(e.Left)
+		r.expr(e.Low)
+		r.expr(e.High)
+	case *ast.StructLiteral:
+		for _, v := range e.Values {
+			r.expr(v)
+		}
+	case *ast.SelectorExpression:
+		r.expr(e.Left)
+	case *ast.TypeAssertion:
+		r.expr(e.Left)
+	}
+}
+
+// function resolves a function literal. Its receiver, parameters and body
+// share the scope of the function.
+func (r *Resolver) function(fn *ast.FunctionLiteral) {
+	if fn.Name != nil && fn.Receiver == nil {
+		if _, ok := r.scope.names[fn.Name.Value]; !ok {
+			r.declare(fn.Name)
+		}
+	}
+
+	r.open(true)
+	defer r.close()
+
+	if fn.Receiver != nil {
+		r.declare(fn.Receiver)
+	}
+	for _, arg := range fn.Args {
+		r.declare(arg)
+	}
+	r.block(fn.Body)
+}
+
+// pattern resolves the pattern of a match arm, declaring the names it
+// binds. A name that is an enum variant is used, not bound.
+func (r *Resolver) pattern(p ast.Expression) {
+	switch p := p.(type) {
+	case *ast.Identifier:
+		if p.Value == "_" {
+			return
+		}
+		if binding, d := r.lookup(p.Value); d != nil && d.Variant {
+			p.Binding = binding
+			return
+		}
+		r.declare(p)
+	case *ast.CallExpression:
+		r.expr(p.Function)
+		for _, arg := range p.Args {
+			r.pattern(arg)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range p.Elements {
+			r.pattern(el)
+		}
+	case *ast.RestPattern:
+		if p.Name != nil {
+			r.declare(p.Name)
+		}
+	default:
+		r.expr(p)
+	}
+}
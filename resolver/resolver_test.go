@@ -0,0 +1,176 @@
+package resolver
+
+import (
+	"dao/ast"
+	"dao/diag"
+	"dao/lexer"
+	"dao/parser"
+	"fmt"
+	"testing"
+)
+
+func TestResolveDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`var x = 1; x = 2; x += 1; x++`, nil},
+		{`x = 1`, []string{`error E0300 1:1: cannot assign to undeclared name x`}},
+		{`x++`, []string{`error E0300 1:1: cannot assign to undeclared name x`}},
+		{`if true { var y = 1 }; y = 2`, []string{`error E0300 1:24: cannot assign to undeclared name y`}},
+		{`for var i = 0; i++; i < 3 {}; i = 0`, []string{`error E0300 1:31: cannot assign to undeclared name i`}},
+		{`enum E { A }; A = 1`, []string{`error E0300 1:15: cannot assign to undeclared name A`}},
+		{`func f() { var a = 1; if true { var a = 2 } }`, []string{`warning E0301 1:37: declaration of a shadows the declaration at line 1`}},
+		{`func f(a int) { for var a = 0; a++; a < 1 {} }`, []string{`warning E0301 1:25: declaration of a shadows the declaration at line 1`}},
+		{`func f(a int) { match 1 { a => a } }`, []string{`warning E0301 1:27: declaration of a shadows the declaration at line 1`}},
+		{`var a = 1; func f() { var a = 2 }`, nil},
+		{`var x = 1; if true { var x = 2 }`, []string{`warning E0301 1:26: declaration of x shadows the declaration at line 1`}},
+		{`if true { var x = 2 }; var x = 1`, nil},
+		{`y + 1`, []string{`error E0300 1:1: undeclared name y`}},
+		{`func f() { g(z) }; func g(a int) { len(a) }`, []string{`error E0300 1:14: undeclared name z`}},
+		{`if true { var y = 1 }; y`, []string{`error E0300 1:24: undeclared name y`}},
+		{`func f(a int) { func(a int) { a } }`, nil},
+		{`func f() { var a = 1; var a = 2 }`, []string{`error E0303 1:27: a redeclared in this block`}},
+		{`func f(a int) { var a = 2 }`, []string{`error E0303 1:21: a redeclared in this block`}},
+		{`var g = 1; func g() {}`, []string{`error E0303 1:5: g redeclared in this block`}},
+		{`enum R { Ok(v) }; func f(r R) { match r { Ok(v) => v, x => x } }`, nil},
+		{`func f() { g() }; func g() { 1 }`, nil},
+		{`const c = 1; c = 2`, []string{`error E0302 1:14: cannot assign to constant c`}},
+		{`const (a = 1; b = 2); func f() { b++ }`, []string{`error E0302 1:34: cannot assign to constant b`}},
+		{`func f() { a = 2 }; const a = 1`, []string{`error E0302 1:12: cannot assign to constant a`}},
+		{`const c = 1; var c = 2; c = 3`, []string{`error E0303 1:18: c redeclared in this block`, `error E0302 1:25: cannot assign to constant c`}},
+		{`const c = 1; const c = 2`, []string{`error E0303 1:20: c redeclared in this block`}},
+		{`var a, b = 1, 2; a, b = b, a`, nil},
+		{`var a = 1; a, c = 1, 2`, []string{`error E0300 1:15: cannot assign to undeclared name c`}},
+		{`const k = 1; var a = 0; a, k = 1, 2`, []string{`error E0302 1:28: cannot assign to constant k`}},
+		{`func f() { var a, b = 1, 2; if true { var a, c = 3, 4 } }`, []string{`warning E0301 1:43: declaration of a shadows the declaration at line 1`}},
+		{`func f() { const c = 1; if true { c += 1 } }`, []string{`error E0302 1:35: cannot assign to constant c`}},
+		{`echo(x); var x = 1`, []string{`error E0300 1:6: x used before its declaration`}},
+		{`var x = x + 1`, []string{`error E0300 1:9: x used before its declaration`}},
+		{`if true { x = 2 }; var x = 1`, []string{`error E0300 1:11: cannot assign to x before its declaration`}},
+		{`func f() { x }; var x = 1; f()`, nil},
+		{`var a = b(); func b() { 1 }`, nil},
+		{`type P struct { x int }; P = 3`, []string{`error E0304 1:26: cannot assign to type P`}},
+		{`enum E { A }; func f() { E++ }`, []string{`error E0304 1:26: cannot assign to type E`}},
+		{`func f() { type P struct { x int }; var a = 0; a, P = 1, 2 }`, []string{`error E0304 1:51: cannot assign to type P`}},
+	}
+
+	for _, tt := range tests {
+		diags := resolve(t, tt.input)
+		if len(diags) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. expected=%d, got=%d (%v)", tt.input, len(tt.expected), len(diags), diags)
+			continue
+		}
+		for i, d := range diags {
+			got := fmt.Sprintf("%s %s %d:%d: %s", d.Severity, d.Code, d.Pos.Line, d.Pos.Column, d.Msg)
+			if got != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q. expected=%q, got=%q", tt.input, tt.expected[i], got)
+			}
+		}
+	}
+}
+
+func TestResolveBindings(t *testing.T) {
+	input := `
+var g = 1
+func f(a int, b int) {
+    var c = a
+    if true {
+        var d = b
+        d + c + g + f
+    }
+}
+`
+	p := parser.New(lexer.New(input))
+	program := p.Parse()
+	if diags := Resolve(program); len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+
+	fn := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	ifexp := fn.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	sum := ifexp.Consequence.Statements[1].(*ast.ExpressionStatement).Expression
+
+	expected := map[string]ast.Binding{
+		"d": {Depth: 0},
+		"c": {Depth: 1},
+		"g": {Depth: -1},
+		"f": {Depth: -1},
+	}
+	for _, name := range identifiers(sum) {
+		want := expected[name.Value]
+		if name.Binding == nil {
+			t.Errorf("%s is not bound", name.Value)
+			continue
+		}
+		if *name.Binding != want {
+			t.Errorf("wrong binding for %s. expected=%+v, got=%+v", name.Value, want, *name.Binding)
+		}
+	}
+
+	b := ifexp.Consequence.Statements[0].(*ast.VarStatement).Value.(*ast.Identifier)
+	if b.Binding == nil || *b.Binding != (ast.Binding{Depth: 1}) {
+		t.Errorf("wrong binding for b. got=%+v", b.Binding)
+	}
+}
+
+func TestResolveBuiltinsUnbound(t *testing.T) {
+	program := parser.New(lexer.New(`len("a")`)).Parse()
+	Resolve(program)
+
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if fn := call.Function.(*ast.Identifier); fn.Binding != nil {
+		t.Errorf("builtin len is bound: %+v", fn.Binding)
+	}
+}
+
+func TestResolveSession(t *testing.T) {
+	r := New()
+	for _, line := range []string{`var a = 1`, `a = 2`, `var a = 3`, `func f() { a }`, `func f() { 2 }`, `var f = 4; const c = 5`, `var a = c`} {
+		program := parser.New(lexer.New(line)).Parse()
+		if diags := r.Resolve(program); len(diags) != 0 {
+			t.Errorf("unexpected diagnostics for %q: %v", line, diags)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`var b = 1; var b = 2`, `error E0303 1:16: b redeclared in this block`},
+		{`var c = 6`, `error E0303 1:5: c redeclared in this block`},
+		{`const c = 6`, `error E0303 1:7: c redeclared in this block`},
+	}
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).Parse()
+		diags := r.Resolve(program)
+		if len(diags) != 1 {
+			t.Errorf("wrong number of diagnostics for %q. expected=1, got=%d (%v)", tt.input, len(diags), diags)
+			continue
+		}
+		d := diags[0]
+		if got := fmt.Sprintf("%s %s %d:%d: %s", d.Severity, d.Code, d.Pos.Line, d.Pos.Column, d.Msg); got != tt.expected {
+			t.Errorf("wrong diagnostic for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func resolve(t *testing.T, input string) []*diag.Diagnostic {
+	p := parser.New(lexer.New(input))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parse errors for %q: %v", input, p.Errors())
+	}
+	return Resolve(program)
+}
+
+// identifiers returns the identifiers of an expression of infix operators.
+func identifiers(e ast.Expression) []*ast.Identifier {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		return []*ast.Identifier{e}
+	case *ast.InfixExpression:
+		return append(identifiers(e.Left), identifiers(e.Right)...)
+	}
+	return nil
+}
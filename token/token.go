@@ -1,10 +1,44 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // 词法单元第一个字符的位置
+	End     Position // 词法单元最后一个字符之后的位置
+
+	Comments []Token // 词法单元之前的注释, 类型为 COMMENT
+}
+
+// Position describes a location in the source: Offset is the byte offset
+// starting at 0, Line and Column start at 1. Column counts bytes.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid reports whether the position has been set.
+func (pos Position) IsValid() bool { return pos.Line > 0 }
+
+// String returns "file:line:column", "line:column" when there is no file
+// name, or "-" for an invalid position.
+func (pos Position) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 func New(tt TokenType, li byte) Token {
@@ -19,25 +53,54 @@ func GetTokenType(id string) TokenType {
 }
 
 var keywords = map[string]TokenType{
-	"func":   FUNC,
-	"var":    VAR,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
-	"nil":    NIL,
-	"return": RETURN,
-	"break":  BREAK,
-	"for":    FOR,
+	"func":        FUNC,
+	"var":         VAR,
+	"const":       CONST,
+	"if":          IF,
+	"else":        ELSE,
+	"true":        TRUE,
+	"false":       FALSE,
+	"nil":         NIL,
+	"return":      RETURN,
+	"break":       BREAK,
+	"continue":    CONTINUE,
+	"for":         FOR,
+	"in":          IN,
+	"type":        TYPE,
+	"struct":      STRUCT,
+	"interface":   INTERFACE,
+	"enum":        ENUM,
+	"match":       MATCH,
+	"switch":      SWITCH,
+	"case":        CASE,
+	"default":     DEFAULT,
+	"fallthrough": FALLTHROUGH,
+}
+
+// Builtins are the names of the builtin functions. They aren't keywords, a
+// program may declare them again; the resolver leaves them unbound, eval
+// and the checker give each its function and its signature.
+var Builtins = map[string]bool{
+	"len":    true,
+	"echo":   true,
+	"puts":   true,
+	"delete": true,
+	"keys":   true,
+	"values": true,
+	"int":    true,
+	"float":  true,
+	"range":  true,
 }
 
 const (
-	ILLEGAL = "ILLEGAL"
+	ILLEGAL = "ILLEGAL" // Literal is the error message
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // // line, /* block */
 
 	// 标识符+字面量
-	ID     = "ID"  // add, foobar, x, y, ...
-	INT    = "INT" // 1343456
+	ID     = "ID"    // add, foobar, x, y, ...
+	INT    = "INT"   // 1343456
+	FLOAT  = "FLOAT" // 1.5, 1e-3
 	STRING = "STRING"
 
 	// 运算符
@@ -54,10 +117,36 @@ const (
 
 	LT = "<"
 	GT = ">"
+	LE = "<="
+	GE = ">="
+
+	AND = "&&"
+	OR  = "||"
+
+	AMP     = "&"
+	PIPE    = "|"
+	CARET   = "^"
+	AND_NOT = "&^"
+	SHL     = "<<"
+	SHR     = ">>"
+	TILDE   = "~"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	MOD_ASSIGN      = "%="
+
+	INC = "++"
+	DEC = "--"
+
+	ARROW = "=>"
 
 	// 分隔符
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	DOT       = "."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -67,14 +156,27 @@ const (
 	RBRACKET = "]"
 
 	// 关键字
-	FUNC   = "FUNC"
-	VAR    = "VAR"
-	IF     = "IF"
-	ELSE   = "ELSE"
-	TRUE   = "TRUE"
-	FALSE  = "FALSE"
-	NIL    = "NIL"
-	RETURN = "RETURN"
-	BREAK  = "BREAK"
-	FOR    = "FOR"
+	FUNC      = "FUNC"
+	VAR       = "VAR"
+	CONST     = "CONST"
+	IF        = "IF"
+	ELSE      = "ELSE"
+	TRUE      = "TRUE"
+	FALSE     = "FALSE"
+	NIL       = "NIL"
+	RETURN    = "RETURN"
+	BREAK     = "BREAK"
+	CONTINUE  = "CONTINUE"
+	FOR       = "FOR"
+	IN        = "IN"
+	TYPE      = "TYPE"
+	STRUCT    = "STRUCT"
+	INTERFACE = "INTERFACE"
+	ENUM      = "ENUM"
+	MATCH     = "MATCH"
+
+	SWITCH      = "SWITCH"
+	CASE        = "CASE"
+	DEFAULT     = "DEFAULT"
+	FALLTHROUGH = "FALLTHROUGH"
 )
@@ -0,0 +1,1168 @@
+package types
+
+import (
+	"dao/ast"
+	"dao/diag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Var is a name in scope. A Declared var has a type annotation that every
+// assignment must respect, the type of an undeclared one follows the
+// values assigned to it and falls back to Any once they disagree.
+type Var struct {
+	Name     string
+	Type     Type
+	Declared bool
+}
+
+// Scope maps names to vars and to the types declared by type statements.
+// Like eval.Env, functions and the blocks of if, for, switch and match open a
+// new scope.
+type Scope struct {
+	vars  map[string]*Var
+	types map[string]Type
+	outer *Scope
+}
+
+func NewScope(outer *Scope) *Scope {
+	return &Scope{vars: make(map[string]*Var), types: make(map[string]Type), outer: outer}
+}
+
+func (s *Scope) Lookup(name string) *Var {
+	for ; s != nil; s = s.outer {
+		if v, ok := s.vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *Scope) Declare(name string, t Type, declared bool) *Var {
+	v := &Var{Name: name, Type: t, Declared: declared}
+	s.vars[name] = v
+	return v
+}
+
+// LookupType returns the type declared as name, nil if there is none.
+func (s *Scope) LookupType(name string) Type {
+	for ; s != nil; s = s.outer {
+		if t, ok := s.types[name]; ok {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Scope) DeclareType(name string, t Type) {
+	s.types[name] = t
+}
+
+// Checker walks a program and reports the values that can't match their
+// annotations, and the operations that would fail at runtime whatever the
+// values are. Whatever depends on an unknown (Any) type is let through.
+//
+// Types are inferred in the order the code runs: an untyped var gets the
+// type of its value, a function without a return type returns the type all
+// its returns agree on, array and hash literals get the type of their
+// elements.
+type Checker struct {
+	scope   *Scope
+	fn      *Func  // signature of the function being checked, nil at top level
+	returns []Type // types returned so far by fn
+	types   map[ast.Expression]Type
+	sigs    map[*ast.FunctionLiteral]*Func
+	diags   []*diag.Diagnostic
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		scope: NewScope(nil),
+		types: make(map[ast.Expression]Type),
+		sigs:  make(map[*ast.FunctionLiteral]*Func),
+	}
+}
+
+// Check checks a whole program.
+func Check(program *ast.Program) []*diag.Diagnostic {
+	return NewChecker().Check(program)
+}
+
+// Check checks program and returns its diagnostics. The names it declares
+// stay in scope for the next call, as in a REPL session.
+func (c *Checker) Check(program *ast.Program) []*diag.Diagnostic {
+	c.diags = nil
+	c.declare(program.Statements)
+	for _, stmt := range program.Statements {
+		c.stmt(stmt)
+	}
+	return c.diags
+}
+
+func (c *Checker) errorf(n ast.Node, code string, format string, a ...interface{}) *diag.Diagnostic {
+	d := &diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     code,
+		Msg:      fmt.Sprintf(format, a...),
+		Pos:      n.Pos(),
+		End:      n.End(),
+	}
+	c.diags = append(c.diags, d)
+	return d
+}
+
+// annotation returns the type named by a type annotation.
+func (c *Checker) annotation(name *ast.Identifier) Type {
+	if name == nil {
+		return Any
+	}
+	if t, ok := Lookup(name.Value); ok {
+		return t
+	}
+	if t := c.scope.LookupType(name.Value); t != nil {
+		return t
+	}
+	c.errorf(name, diag.UndefinedType, "undefined type: %s", name.Value)
+	return Any
+}
+
+// declare declares the types of a list of statements, the methods on them
+// and the variants of enums, ahead of checking the statements: a function
+// may use a type or a method declared after it.
+func (c *Checker) declare(stmts []ast.Statement) {
+	types := []*ast.TypeStatement{}
+	for _, stmt := range stmts {
+		if es, ok := stmt.(*ast.EnumStatement); ok {
+			c.enum(es)
+			continue
+		}
+		ts, ok := stmt.(*ast.TypeStatement)
+		if !ok {
+			continue
+		}
+		if _, ok := ts.Type.(*ast.InterfaceType); ok {
+			c.scope.DeclareType(ts.Name.Value, &Interface{Name: ts.Name.Value, Methods: map[string]*Func{}})
+		} else {
+			c.scope.DeclareType(ts.Name.Value, &Struct{Name: ts.Name.Value, Methods: map[string]*Func{}})
+		}
+		types = append(types, ts)
+	}
+
+	// fields and methods are declared once all the names are known, they
+	// can use a type declared later, or the type they belong to.
+	for _, ts := range types {
+		switch t := c.scope.LookupType(ts.Name.Value).(type) {
+		case *Struct:
+			for _, f := range ts.Type.(*ast.StructType).Fields {
+				t.Fields = append(t.Fields, &Var{Name: f.Value, Type: c.annotation(f.Type), Declared: true})
+			}
+		case *Interface:
+			for _, m := range ts.Type.(*ast.InterfaceType).Methods {
+				t.Methods[m.Name.Value] = c.signature(m)
+			}
+		}
+	}
+
+	for _, stmt := range stmts {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		if fn, ok := es.Expression.(*ast.FunctionLiteral); ok && fn.Receiver != nil {
+			if s, ok := c.scope.LookupType(fn.Receiver.Type.Value).(*Struct); ok && s.Field(fn.Name.Value) == nil {
+				s.Methods[fn.Name.Value] = c.signature(fn)
+			}
+		}
+	}
+}
+
+// enum declares an enum type and its variants.
+func (c *Checker) enum(es *ast.EnumStatement) {
+	enum := &Enum{Name: es.Name.Value}
+	for _, v := range es.Variants {
+		variant := &Var{Name: v.Name.Value, Type: enum, Declared: true}
+		if len(v.Fields) > 0 {
+			fn := &Func{Result: enum}
+			for _, f := range v.Fields {
+				fn.Params = append(fn.Params, Any)
+				fn.Names = append(fn.Names, f.Value)
+			}
+			variant.Type = fn
+		}
+		enum.Variants = append(enum.Variants, variant)
+		c.scope.vars[variant.Name] = variant
+	}
+	c.scope.DeclareType(enum.Name, enum)
+}
+
+// assignable reports a value of type t that can't be used as want, in is
+// where it is used: "assignment", "return statement", ...
+func (c *Checker) assignable(value ast.Expression, t, want Type, in string) {
+	if !AssignableTo(t, want) {
+		d := c.errorf(value, diag.MismatchedType, "cannot use %s (type %s) as %s in %s", source(value), t, want, in)
+		if iface, ok := want.(*Interface); ok && t != Nil {
+			d.Hint = fmt.Sprintf("%s does not implement %s (missing method %s)", t, iface, Missing(t, iface))
+		}
+	}
+}
+
+func (c *Checker) stmt(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		c.expr(s.Expression)
+	case *ast.VarStatement:
+		names := s.Idents()
+		ts := c.unpack(s.Value, c.expr(s.Value), len(names))
+		context := "variable declaration"
+		if s.Literal() == "const" {
+			context = "constant declaration"
+		}
+		for i, name := range names {
+			if name.Type == nil {
+				// var x = nil says nothing of what x is going to hold
+				t := ts[i]
+				if t == Nil {
+					t = Any
+				}
+				c.scope.Declare(name.Value, t, false)
+				continue
+			}
+			want := c.annotation(name.Type)
+			c.assignable(element(s.Value, i, len(names)), ts[i], want, context)
+			c.scope.Declare(name.Value, want, true)
+		}
+	case *ast.ConstStatement:
+		for _, spec := range s.Specs {
+			c.stmt(spec)
+		}
+	case *ast.AssignStatement:
+		if s.Targets != nil {
+			ts := c.unpack(s.Value, c.expr(s.Value), len(s.Targets))
+			for i, target := range s.Targets {
+				c.store(target, element(s.Value, i, len(s.Targets)), ts[i])
+			}
+			return
+		}
+		t := c.unpack(s.Value, c.expr(s.Value), 1)[0]
+		op := strings.TrimSuffix(s.Operator, "=")
+		if s.Target != nil {
+			target := c.expr(s.Target)
+			value := ast.Node(s.Value)
+			if op != "" {
+				t, value = c.binary(s, op, target, t), s
+			}
+			if sel, ok := s.Target.(*ast.SelectorExpression); ok {
+				c.field(sel, value, t)
+			}
+			c.storeElem(s.Target, t)
+			return
+		}
+		if op == "" {
+			c.assign(s.Name, s.Value, t)
+			return
+		}
+		c.assign(s.Name, s, c.binary(s, op, c.varType(s.Name), t))
+	case *ast.IncDecStatement:
+		op := s.Token.Literal[:1]
+		if name, ok := s.Target.(*ast.Identifier); ok {
+			c.assign(name, s, c.binary(s, op, c.varType(name), Int))
+			return
+		}
+		t := c.binary(s, op, c.expr(s.Target), Int)
+		if sel, ok := s.Target.(*ast.SelectorExpression); ok {
+			c.field(sel, s, t)
+		}
+	case *ast.ReturnStatement:
+		if s.ReturnValue == nil {
+			c.returns = append(c.returns, Nil)
+			return
+		}
+		t := c.expr(s.ReturnValue)
+		if c.fn != nil {
+			c.returns = append(c.returns, t)
+			c.result(s.ReturnValue, t, c.fn.Result)
+		}
+	case *ast.ForStatement:
+		c.open()
+		defer c.close()
+		if s.Range != nil {
+			c.rangeVars(s)
+			c.block(s.Body)
+			return
+		}
+		for _, clause := range s.Condition {
+			c.stmt(clause)
+		}
+		c.scoped(s.Body)
+	case *ast.SwitchStatement:
+		if s.Tag != nil {
+			c.expr(s.Tag)
+		}
+		for _, clause := range s.Cases {
+			for _, v := range clause.Values {
+				c.expr(v)
+			}
+			c.scoped(clause.Body)
+		}
+	case *ast.BlockStatement:
+		c.block(s)
+	}
+}
+
+// rangeVars declares the variables of a range loop with the types of the
+// keys and the values of what it ranges over.
+func (c *Checker) rangeVars(s *ast.ForStatement) {
+	key, value := Type(Any), Type(Any)
+	switch t := c.expr(s.Range).(type) {
+	case *Array:
+		key, value = Int, t.Elem
+	case *Hash:
+		key, value = t.Key, t.Value
+		if s.Key == nil {
+			value = t.Key
+		}
+	default:
+		switch t {
+		case String:
+			key, value = Int, String
+		case Int:
+			value = Int
+			if s.Key != nil {
+				c.errorf(s.Value, diag.InvalidOp, "range over %s (type int) permits only one iteration variable", source(s.Range))
+			}
+		case Any:
+		default:
+			c.errorf(s.Range, diag.InvalidOp, "cannot range over %s (type %s)", source(s.Range), t)
+		}
+	}
+
+	if s.Key != nil && s.Key.Value != "_" {
+		c.scope.Declare(s.Key.Value, key, false)
+	}
+	if s.Value.Value != "_" {
+		c.scope.Declare(s.Value.Value, value, false)
+	}
+}
+
+// field checks the assignment of value, of type t, to the field selected
+// by target.
+func (c *Checker) field(target *ast.SelectorExpression, value ast.Node, t Type) {
+	s, ok := c.TypeOf(target.Left).(*Struct)
+	if !ok {
+		return
+	}
+	f := s.Field(target.Field.Value)
+	if f == nil {
+		if s.Methods[target.Field.Value] != nil {
+			c.errorf(target, diag.InvalidOp, "cannot assign to method %s", source(target))
+		}
+		return
+	}
+	if !AssignableTo(t, f.Type) {
+		c.errorf(value, diag.MismatchedType, "cannot use %s (type %s) as %s in assignment to %s", source(value), t, f.Type, source(target))
+	}
+}
+
+// unpack returns the types of the n values of value, of type t, a tuple
+// unless n is 1. The types are Any when they are unknown or when value
+// doesn't hold n values.
+func (c *Checker) unpack(value ast.Expression, t Type, n int) []Type {
+	ts := []Type{t}
+	if tuple, ok := t.(*Tuple); ok {
+		ts = tuple.Elems
+	}
+
+	if t != Any && len(ts) != n {
+		values := diag.Plural(len(ts), "value")
+		if _, ok := value.(*ast.CallExpression); ok {
+			values = source(value) + " returns " + values
+		}
+		c.errorf(value, diag.AssignMismatch, "assignment mismatch: %s but %s", diag.Plural(n, "variable"), values)
+	}
+	if t == Any || len(ts) != n {
+		ts = make([]Type, n)
+		for i := range ts {
+			ts[i] = Any
+		}
+	}
+	return ts
+}
+
+// element returns the expression of the i-th of the n values of value:
+// the i-th element of a tuple literal of n, value itself otherwise.
+func element(value ast.Expression, i, n int) ast.Expression {
+	if tuple, ok := value.(*ast.TupleLiteral); ok && len(tuple.Elements) == n {
+		return tuple.Elements[i]
+	}
+	return value
+}
+
+// store checks the assignment of value, of type t, to one of the targets
+// of a tuple assignment.
+func (c *Checker) store(target ast.Expression, value ast.Node, t Type) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		c.assign(target, value, t)
+	case *ast.SelectorExpression:
+		c.expr(target)
+		c.field(target, value, t)
+	default:
+		c.expr(target)
+		c.storeElem(target, t)
+	}
+}
+
+// result checks a returned value, of type t, against the result type of
+// the function.
+func (c *Checker) result(value ast.Expression, t, want Type) {
+	have, ok := t.(*Tuple)
+	if !ok {
+		have = &Tuple{Elems: []Type{t}}
+	}
+	results, ok := want.(*Tuple)
+	if !ok {
+		results = &Tuple{Elems: []Type{want}}
+	}
+
+	switch {
+	case t == Any || want == Any || len(have.Elems) == len(results.Elems):
+		c.assignable(value, t, want, "return statement")
+	case len(have.Elems) > len(results.Elems):
+		c.errorf(value, diag.AssignMismatch, "too many return values: have %s, want %s", have, results)
+	default:
+		c.errorf(value, diag.AssignMismatch, "not enough return values: have %s, want %s", have, results)
+	}
+}
+
+// varType returns the type of the var name, Any when it isn't declared.
+func (c *Checker) varType(name *ast.Identifier) Type {
+	if v := c.scope.Lookup(name.Value); v != nil {
+		return v.Type
+	}
+	return Any
+}
+
+// assign checks the assignment of value, of type t, to name.
+func (c *Checker) assign(name *ast.Identifier, value ast.Node, t Type) {
+	v := c.scope.Lookup(name.Value)
+	switch {
+	case v == nil:
+		c.scope.Declare(name.Value, t, false)
+	case v.Declared:
+		if !AssignableTo(t, v.Type) {
+			c.errorf(value, diag.MismatchedType, "cannot use %s (type %s) as %s in assignment to %s", source(value), t, v.Type, name.Value)
+		}
+	case !Identical(v.Type, t):
+		v.Type = Any
+	}
+}
+
+func (c *Checker) block(b *ast.BlockStatement) {
+	if b == nil {
+		return
+	}
+	c.declare(b.Statements)
+	for _, stmt := range b.Statements {
+		c.stmt(stmt)
+	}
+}
+
+// scoped checks b in a scope of its own.
+func (c *Checker) scoped(b *ast.BlockStatement) {
+	c.open()
+	c.block(b)
+	c.close()
+}
+
+func (c *Checker) open() {
+	c.scope = NewScope(c.scope)
+}
+
+func (c *Checker) close() {
+	c.scope = c.scope.outer
+}
+
+// TypeOf returns the type found for an expression checked already.
+func (c *Checker) TypeOf(e ast.Expression) Type {
+	if t, ok := c.types[e]; ok {
+		return t
+	}
+	return Any
+}
+
+// expr returns the type of e, reporting the errors found inside it.
+func (c *Checker) expr(e ast.Expression) Type {
+	t := c.exprType(e)
+	if e != nil {
+		c.types[e] = t
+	}
+	return t
+}
+
+func (c *Checker) exprType(e ast.Expression) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.FloatLiteral:
+		return Float
+	case *ast.StringLiteral:
+		return String
+	case *ast.BooleanLiteral:
+		return Bool
+	case *ast.NilLiteral:
+		return Nil
+	case *ast.Identifier:
+		if v := c.scope.Lookup(e.Value); v != nil {
+			return v.Type
+		}
+		if fn, ok := builtins[e.Value]; ok {
+			return fn
+		}
+		return Any
+	case *ast.PrefixExpression:
+		return c.unary(e, c.expr(e.Right))
+	case *ast.InfixExpression:
+		left := c.expr(e.Left)
+		right := c.expr(e.Right)
+		return c.binary(e, e.Operator, left, right)
+	case *ast.MatchExpression:
+		return c.match(e)
+	case *ast.IfExpression:
+		c.single(e.Condition)
+		c.scoped(e.Consequence)
+		values := []Type{c.blockType(e.Consequence)}
+		for _, option := range e.Options {
+			c.single(option.Condition)
+			c.scoped(option.Consequence)
+			values = append(values, c.blockType(option.Consequence))
+		}
+		if e.Alternative == nil {
+			return Any
+		}
+		c.scoped(e.Alternative)
+		return unify(append(values, c.blockType(e.Alternative)))
+	case *ast.FunctionLiteral:
+		return c.function(e)
+	case *ast.CallExpression:
+		return c.call(e)
+	case *ast.ArrayLiteral:
+		elems := []Type{}
+		for _, el := range e.Elements {
+			elems = append(elems, c.single(el))
+		}
+		return &Array{Elem: unify(elems)}
+	case *ast.TupleLiteral:
+		elems := []Type{}
+		for _, el := range e.Elements {
+			elems = append(elems, c.single(el))
+		}
+		return &Tuple{Elems: elems}
+	case *ast.HashLiteral:
+		keys, values := []Type{}, []Type{}
+		for i, key := range e.Keys {
+			k := c.single(key)
+			c.hashKey(key, k)
+			keys = append(keys, k)
+			values = append(values, c.single(e.Values[i]))
+		}
+		return &Hash{Key: unify(keys), Value: unify(values)}
+	case *ast.IndexExpression:
+		return c.index(e)
+	case *ast.StructLiteral:
+		return c.structLiteral(e)
+	case *ast.SelectorExpression:
+		return c.selector(e, c.expr(e.Left))
+	case *ast.TypeAssertion:
+		return c.typeAssertion(e, c.expr(e.Left))
+	case *ast.SliceExpression:
+		left := c.expr(e.Left)
+		for _, bound := range []ast.Expression{e.Low, e.High} {
+			if bound != nil {
+				c.intIndex(bound, c.expr(bound))
+			}
+		}
+		if _, ok := left.(*Array); !ok && left != Any {
+			c.errorf(e, diag.InvalidOp, "invalid operation: cannot slice %s (type %s)", source(e.Left), left)
+			return Any
+		}
+		return left
+	}
+	return Any
+}
+
+func (c *Checker) unary(e *ast.PrefixExpression, t Type) Type {
+	switch e.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if isNumeric(t) || t == Any {
+			return t
+		}
+	case "~":
+		if t == Int || t == Any {
+			return Int
+		}
+	}
+	c.errorf(e, diag.InvalidOp, "invalid operation: operator %s not defined on %s (type %s)", e.Operator, source(e.Right), t)
+	return Any
+}
+
+// binary returns the type of left op right, as computed by eval.infixExp.
+func (c *Checker) binary(n ast.Node, op string, left, right Type) Type {
+	switch op {
+	case "&&", "||", "==", "!=":
+		return Bool
+	case "in":
+		switch right.(type) {
+		case *Array:
+			return Bool
+		case *Hash:
+			c.hashKey(n, left)
+			return Bool
+		}
+		if right == Any {
+			return Bool
+		}
+	}
+
+	comparison := op == "<" || op == ">" || op == "<=" || op == ">="
+	switch {
+	case left == Any || right == Any:
+		if comparison {
+			return Bool
+		}
+		return Any
+	case left == Int && right == Int:
+		if comparison {
+			return Bool
+		}
+		return Int
+	case isNumeric(left) && isNumeric(right):
+		if comparison {
+			return Bool
+		}
+		switch op {
+		case "+", "-", "*", "/", "%":
+			return Float
+		}
+	case left == String && right == String:
+		if comparison {
+			return Bool
+		}
+		if op == "+" {
+			return String
+		}
+	case op == "*" && (left == String && right == Int || left == Int && right == String):
+		return String
+	case op == "+":
+		l, lok := left.(*Array)
+		r, rok := right.(*Array)
+		if lok && rok {
+			return &Array{Elem: unify([]Type{l.Elem, r.Elem})}
+		}
+	}
+
+	if Identical(left, right) {
+		c.errorf(n, diag.InvalidOp, "invalid operation: operator %s not defined on %s", op, left)
+	} else {
+		c.errorf(n, diag.InvalidOp, "invalid operation: %s (mismatched types %s and %s)", source(n), left, right)
+	}
+	return Any
+}
+
+func (c *Checker) hashKey(n ast.Node, t Type) {
+	switch t {
+	case Int, String, Bool, Any:
+		return
+	}
+	c.errorf(n, diag.InvalidOp, "invalid hash key %s (type %s)", source(n), t)
+}
+
+func (c *Checker) intIndex(n ast.Expression, t Type) {
+	if t != Int && t != Any {
+		c.errorf(n, diag.MismatchedType, "invalid array index %s (type %s), must be int", source(n), t)
+	}
+}
+
+func (c *Checker) index(e *ast.IndexExpression) Type {
+	left := c.expr(e.Left)
+	index := c.expr(e.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		c.intIndex(e.Index, index)
+		return left.Elem
+	case *Hash:
+		c.hashKey(e.Index, index)
+		return left.Value
+	}
+	if left != Any {
+		c.errorf(e, diag.InvalidOp, "invalid operation: cannot index %s (type %s)", source(e.Left), left)
+	}
+	return Any
+}
+
+func (c *Checker) structLiteral(e *ast.StructLiteral) Type {
+	t := c.annotation(e.Name)
+	s, ok := t.(*Struct)
+	if !ok {
+		if t != Any {
+			c.errorf(e.Name, diag.InvalidOp, "invalid composite literal type %s", t)
+		}
+		for _, v := range e.Values {
+			c.expr(v)
+		}
+		return Any
+	}
+
+	for i, name := range e.Fields {
+		t := c.expr(e.Values[i])
+		f := s.Field(name.Value)
+		if f == nil {
+			c.errorf(name, diag.UndefinedField, "unknown field %s in struct literal of type %s", name.Value, s)
+			continue
+		}
+		c.assignable(e.Values[i], t, f.Type, "struct literal")
+	}
+	return s
+}
+
+// selector returns the type of the field or method e selects on a value
+// of type left.
+func (c *Checker) selector(e *ast.SelectorExpression, left Type) Type {
+	if left == Any {
+		return Any
+	}
+	switch t := left.(type) {
+	case *Struct:
+		if f := t.Field(e.Field.Value); f != nil {
+			return f.Type
+		}
+		if m, ok := t.Methods[e.Field.Value]; ok {
+			return m
+		}
+	case *Interface:
+		if m, ok := t.Methods[e.Field.Value]; ok {
+			return m
+		}
+	}
+	c.errorf(e, diag.UndefinedField, "%s undefined (type %s has no field or method %s)", source(e), left, e.Field.Value)
+	return Any
+}
+
+// typeAssertion checks e, whose left side is of type left, and returns
+// the asserted type.
+func (c *Checker) typeAssertion(e *ast.TypeAssertion, left Type) Type {
+	t := c.annotation(e.Type)
+	iface, ok := left.(*Interface)
+	if !ok {
+		if left != Any {
+			c.errorf(e.Left, diag.InvalidOp, "invalid operation: %s (type %s) is not an interface", source(e.Left), left)
+		}
+		return t
+	}
+
+	if _, isIface := t.(*Interface); !isIface && t != Any {
+		if missing := Missing(t, iface); missing != "" {
+			c.errorf(e, diag.InvalidOp, "impossible type assertion: %s does not implement %s (missing method %s)", t, iface, missing)
+		}
+	}
+	return t
+}
+
+// match checks the patterns and the arms of a match expression. A match
+// on an enum that neither covers all its variants nor has an arm matching
+// anything gets a warning: the missing variants would give nil. The type of
+// the match is the type its arms agree on, Any unless it is exhaustive.
+func (c *Checker) match(e *ast.MatchExpression) Type {
+	subject := c.expr(e.Subject)
+
+	all := false
+	covered := map[string]bool{}
+	arms := []Type{}
+	for _, arm := range e.Arms {
+		c.open()
+		irrefutable, variant := c.pattern(arm.Pattern, subject)
+		all = all || irrefutable
+		covered[variant] = true
+		c.block(arm.Body)
+		c.close()
+		arms = append(arms, c.blockType(arm.Body))
+	}
+
+	enum, ok := subject.(*Enum)
+	if all {
+		return unify(arms)
+	}
+	if !ok {
+		return Any
+	}
+
+	missing := []string{}
+	for _, v := range enum.Variants {
+		if !covered[v.Name] {
+			missing = append(missing, v.Name)
+		}
+	}
+	if len(missing) == 0 {
+		return unify(arms)
+	}
+	d := c.errorf(e.Subject, diag.NonExhaustive, "non-exhaustive match: %s not covered", strings.Join(missing, ", "))
+	d.Severity = diag.Warning
+	d.Hint = "add the missing variants, or a _ arm"
+	return Any
+}
+
+// pattern checks the pattern p against a value of type t and declares the
+// names it binds. irrefutable is true when p matches any value, variant is
+// the enum variant p matches whatever its values, if any.
+func (c *Checker) pattern(p ast.Expression, t Type) (irrefutable bool, variant string) {
+	switch p := p.(type) {
+	case *ast.Identifier:
+		if p.Value == "_" {
+			return true, ""
+		}
+		enum, v := c.variant(p.Value)
+		if v == nil {
+			c.scope.Declare(p.Value, t, false)
+			return true, ""
+		}
+		c.patternType(p, enum, t)
+		if fn, ok := v.Type.(*Func); ok {
+			c.errorf(p, diag.WrongArgCount, "wrong number of values in pattern %s: got 0, want %d", p.Value, len(fn.Params))
+			return false, ""
+		}
+		return false, v.Name
+	case *ast.CallExpression:
+		name := p.Function.(*ast.Identifier)
+		enum, v := c.variant(name.Value)
+		var fn *Func
+		if v != nil {
+			fn, _ = v.Type.(*Func)
+		}
+		if fn == nil {
+			c.errorf(name, diag.InvalidOp, "%s is not a variant with values", name.Value)
+			return false, ""
+		}
+		c.patternType(p, enum, t)
+		if len(p.Args) != len(fn.Params) {
+			c.errorf(p, diag.WrongArgCount, "wrong number of values in pattern %s: got %d, want %d", name.Value, len(p.Args), len(fn.Params))
+			return false, ""
+		}
+		all := true
+		for i, arg := range p.Args {
+			irrefutable, _ := c.pattern(arg, fn.Params[i])
+			all = all && irrefutable
+		}
+		if all {
+			return false, v.Name
+		}
+		return false, ""
+	case *ast.ArrayLiteral:
+		elem := Type(Any)
+		switch t := t.(type) {
+		case *Array:
+			elem = t.Elem
+		default:
+			if t != Any {
+				c.errorf(p, diag.MismatchedType, "pattern %s cannot match type %s", source(p), t)
+			}
+		}
+		for _, el := range p.Elements {
+			if rest, ok := el.(*ast.RestPattern); ok {
+				if rest.Name != nil {
+					c.scope.Declare(rest.Name.Value, &Array{Elem: elem}, false)
+				}
+				return len(p.Elements) == 1, ""
+			}
+			c.pattern(el, elem)
+		}
+		return false, ""
+	}
+
+	lt := c.expr(p)
+	if !AssignableTo(lt, t) && !AssignableTo(t, lt) {
+		c.errorf(p, diag.MismatchedType, "pattern %s (type %s) cannot match type %s", source(p), lt, t)
+	}
+	return false, ""
+}
+
+// patternType reports a variant pattern p of enum that can't match a
+// value of type t.
+func (c *Checker) patternType(p ast.Expression, enum *Enum, t Type) {
+	if t != Any && t != Type(enum) {
+		c.errorf(p, diag.MismatchedType, "pattern %s (type %s) cannot match type %s", source(p), enum, t)
+	}
+}
+
+// variant returns the enum variant called name, nil if name is not one.
+func (c *Checker) variant(name string) (*Enum, *Var) {
+	v := c.scope.Lookup(name)
+	if v == nil {
+		return nil, nil
+	}
+	enum, ok := v.Type.(*Enum)
+	if fn, isFunc := v.Type.(*Func); isFunc {
+		enum, ok = fn.Result.(*Enum)
+	}
+	if !ok || enum.Variant(name) != v {
+		return nil, nil
+	}
+	return enum, v
+}
+
+// signature returns the signature of fn, it is only built once.
+func (c *Checker) signature(fn *ast.FunctionLiteral) *Func {
+	if sig, ok := c.sigs[fn]; ok {
+		return sig
+	}
+	sig := &Func{Result: c.annotation(fn.ReturnType)}
+	if fn.ReturnTypes != nil {
+		results := &Tuple{}
+		for _, t := range fn.ReturnTypes {
+			results.Elems = append(results.Elems, c.annotation(t))
+		}
+		sig.Result = results
+	}
+	for _, arg := range fn.Args {
+		sig.Params = append(sig.Params, c.annotation(arg.Type))
+		sig.Names = append(sig.Names, arg.Value)
+	}
+	c.sigs[fn] = sig
+	return sig
+}
+
+// method adds the method fn to the struct type of its receiver and
+// returns that type.
+func (c *Checker) method(fn *ast.FunctionLiteral, sig *Func) Type {
+	t := c.annotation(fn.Receiver.Type)
+	s, ok := t.(*Struct)
+	if !ok {
+		if t != Any {
+			c.errorf(fn.Receiver.Type, diag.InvalidOp, "invalid receiver type %s", t)
+		}
+		return Any
+	}
+	if s.Field(fn.Name.Value) != nil {
+		c.errorf(fn.Name, diag.InvalidOp, "field and method with the same name %s", fn.Name.Value)
+		return s
+	}
+	s.Methods[fn.Name.Value] = sig
+	return s
+}
+
+func (c *Checker) function(fn *ast.FunctionLiteral) Type {
+	sig := c.signature(fn)
+	var receiver Type
+	switch {
+	case fn.Receiver != nil:
+		receiver = c.method(fn, sig)
+	case fn.Name != nil:
+		c.scope.Declare(fn.Name.Value, sig, true)
+	}
+
+	scope, outer, returns := c.scope, c.fn, c.returns
+	c.scope, c.fn, c.returns = NewScope(scope), sig, nil
+	defer func() { c.scope, c.fn, c.returns = scope, outer, returns }()
+
+	if receiver != nil {
+		c.scope.Declare(fn.Receiver.Value, receiver, true)
+	}
+	for i, arg := range fn.Args {
+		c.scope.Declare(arg.Value, sig.Params[i], true)
+	}
+	c.block(fn.Body)
+
+	// the value of the last expression is returned as well
+	var last ast.Statement
+	if fn.Body != nil && len(fn.Body.Statements) > 0 {
+		last = fn.Body.Statements[len(fn.Body.Statements)-1]
+	}
+	if stmt, ok := last.(*ast.ExpressionStatement); ok && stmt.Expression != nil && sig.Result != Any {
+		if _, isIf := stmt.Expression.(*ast.IfExpression); !isIf {
+			c.result(stmt.Expression, c.TypeOf(stmt.Expression), sig.Result)
+		}
+	}
+
+	if fn.ReturnType == nil && fn.ReturnTypes == nil {
+		switch last.(type) {
+		case *ast.ReturnStatement:
+			sig.Result = unify(c.returns)
+		case *ast.ExpressionStatement:
+			sig.Result = unify(append(c.returns, c.blockType(fn.Body)))
+		}
+	}
+
+	return sig
+}
+
+// blockType returns the type of the value of a block, the value of its
+// last expression, or Any.
+func (c *Checker) blockType(b *ast.BlockStatement) Type {
+	if b == nil || len(b.Statements) == 0 {
+		return Any
+	}
+	if stmt, ok := b.Statements[len(b.Statements)-1].(*ast.ExpressionStatement); ok && stmt.Expression != nil {
+		return c.TypeOf(stmt.Expression)
+	}
+	return Any
+}
+
+// storeElem widens the element type of the array or hash target is an
+// index of, when it is given a value of another type.
+func (c *Checker) storeElem(target ast.Expression, t Type) {
+	index, ok := target.(*ast.IndexExpression)
+	if !ok {
+		return
+	}
+
+	switch container := c.TypeOf(index.Left).(type) {
+	case *Array:
+		if !Identical(container.Elem, t) {
+			container.Elem = Any
+		}
+	case *Hash:
+		if !Identical(container.Key, c.TypeOf(index.Index)) {
+			container.Key = Any
+		}
+		if !Identical(container.Value, t) {
+			container.Value = Any
+		}
+	}
+}
+
+func (c *Checker) call(call *ast.CallExpression) Type {
+	callee := c.expr(call.Function)
+	args := []Type{}
+	for _, arg := range call.Args {
+		args = append(args, c.single(arg))
+	}
+
+	fn, ok := callee.(*Func)
+	if !ok {
+		if callee != Any {
+			c.errorf(call.Function, diag.InvalidOp, "invalid operation: cannot call non-function %s (type %s)", source(call.Function), callee)
+		}
+		return Any
+	}
+
+	name := source(call.Function)
+	want := len(fn.Params)
+	if fn.Variadic && len(args) < want-1 || !fn.Variadic && len(args) < want {
+		c.argCount(call, "not enough", name, args, fn)
+		return fn.Result
+	}
+	if !fn.Variadic && len(args) > want {
+		c.argCount(call, "too many", name, args, fn)
+		return fn.Result
+	}
+
+	for i, arg := range call.Args {
+		param := fn.Params[len(fn.Params)-1]
+		if i < len(fn.Params) {
+			param = fn.Params[i]
+		}
+		in := "argument to " + name
+		if i < len(fn.Names) {
+			in = fmt.Sprintf("argument %s of %s", fn.Names[i], name)
+		}
+		c.assignable(arg, args[i], param, in)
+	}
+	return fn.Result
+}
+
+func (c *Checker) argCount(call *ast.CallExpression, which, name string, args []Type, fn *Func) {
+	have := []string{}
+	for _, t := range args {
+		have = append(have, t.String())
+	}
+	want := strings.TrimPrefix(fn.String(), "func")
+	if fn.Result != Any {
+		want = strings.TrimSuffix(want, " "+fn.Result.String())
+	}
+	d := c.errorf(call, diag.WrongArgCount, "%s arguments in call to %s", which, name)
+	d.Hint = fmt.Sprintf("have (%s), want %s", strings.Join(have, ", "), want)
+}
+
+// single returns the type of e where one value is expected, Any after an
+// error when e is a call with several results.
+func (c *Checker) single(e ast.Expression) Type {
+	t := c.expr(e)
+	if _, ok := t.(*Tuple); ok {
+		c.errorf(e, diag.AssignMismatch, "multiple-value %s in single-value context", source(e))
+		return Any
+	}
+	return t
+}
+
+// source returns n as it reads in the source, without the parentheses
+// ast adds around operations.
+func source(n ast.Node) string {
+	s := strings.TrimSuffix(quoted(n), ";")
+	if strings.HasPrefix(s, "(") && closing(s) == len(s)-1 {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+// quoted prints n as its String method does, but with its strings in
+// quotes, so that "a" + 1 doesn't read a + 1 in a message.
+func quoted(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.StringLiteral:
+		return strconv.Quote(n.Value)
+	case *ast.PrefixExpression:
+		return "(" + n.Operator + quoted(n.Right) + ")"
+	case *ast.InfixExpression:
+		return "(" + quoted(n.Left) + " " + n.Operator + " " + quoted(n.Right) + ")"
+	case *ast.CallExpression:
+		return quoted(n.Function) + "(" + quotedList(n.Args) + ")"
+	case *ast.IndexExpression:
+		return "(" + quoted(n.Left) + "[" + quoted(n.Index) + "])"
+	case *ast.SelectorExpression:
+		return quoted(n.Left) + "." + n.Field.String()
+	case *ast.ArrayLiteral:
+		return "[" + quotedList(n.Elements) + "]"
+	case *ast.TupleLiteral:
+		return quotedList(n.Elements)
+	case *ast.HashLiteral:
+		pairs := []string{}
+		for i, key := range n.Keys {
+			pairs = append(pairs, quoted(key)+": "+quoted(n.Values[i]))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *ast.StructLiteral:
+		fields := []string{}
+		for i, f := range n.Fields {
+			fields = append(fields, f.String()+": "+quoted(n.Values[i]))
+		}
+		return n.Name.String() + "{" + strings.Join(fields, ", ") + "}"
+	}
+	return n.String()
+}
+
+func quotedList(exps []ast.Expression) string {
+	list := []string{}
+	for _, e := range exps {
+		list = append(list, quoted(e))
+	}
+	return strings.Join(list, ", ")
+}
+
+// closing returns the index of the parenthesis closing s[0].
+func closing(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
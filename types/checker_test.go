@@ -0,0 +1,349 @@
+package types
+
+import (
+	"dao/ast"
+	"dao/diag"
+	"dao/lexer"
+	"dao/parser"
+	"dao/token"
+	"testing"
+)
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`var a int = "hello"`, []string{`1:13: cannot use "hello" (type string) as int in variable declaration`}},
+		{`const a int = "hello"`, []string{`1:15: cannot use "hello" (type string) as int in constant declaration`}},
+		{`var a int = 1; a = true`, []string{`1:20: cannot use true (type bool) as int in assignment to a`}},
+		{`var a string = "x"; a += 1`, []string{`1:21: invalid operation: a += 1 (mismatched types string and int)`}},
+		{`var a string = "x"; a++`, []string{`1:21: invalid operation: a++ (mismatched types string and int)`}},
+		{`var a foo = 1`, []string{`1:7: undefined type: foo`}},
+		{`for v in 1.5 {}`, []string{`1:10: cannot range over 1.5 (type float)`}},
+		{`for i, v in 3 {}`, []string{`1:8: range over 3 (type int) permits only one iteration variable`}},
+		{`for i, c in "ab" { c + i }`, []string{`1:20: invalid operation: c + i (mismatched types string and int)`}},
+		{`for k in ({"a": 1}) { k - 1 }`, []string{`1:23: invalid operation: k - 1 (mismatched types string and int)`}},
+		{`var n int = 0; for _, v in ["a"] { n = v }`, []string{`1:40: cannot use v (type string) as int in assignment to n`}},
+		{`switch 1 { case "a" + 1: var n int = "x"; default: foo(1) + true }`, []string{
+			`1:17: invalid operation: "a" + 1 (mismatched types string and int)`,
+			`1:38: cannot use "x" (type string) as int in variable declaration`,
+		}},
+		{`func f(x int, y string) { x }; f(1)`, []string{`1:32: not enough arguments in call to f`}},
+		{`func f(x int) { x }; f(1, 2)`, []string{`1:22: too many arguments in call to f`}},
+		{`func f(x int, y string) { x }; f(1, 2)`, []string{`1:37: cannot use 2 (type int) as string in argument y of f`}},
+		{`func f() int { return "a" }`, []string{`1:23: cannot use "a" (type string) as int in return statement`}},
+		{`func f() int { "a" + "b" }`, []string{`1:16: cannot use "a" + "b" (type string) as int in return statement`}},
+		{`func f() int { puts(1) }`, []string{`1:16: cannot use puts(1) (type nil) as int in return statement`}},
+		{`func f() string { 1 }; var n int = f()`, []string{
+			`1:19: cannot use 1 (type int) as string in return statement`,
+			`1:36: cannot use f() (type string) as int in variable declaration`,
+		}},
+		{`-"a"`, []string{`1:1: invalid operation: operator - not defined on "a" (type string)`}},
+		{`~1.5`, []string{`1:1: invalid operation: operator ~ not defined on 1.5 (type float)`}},
+		{`1.5 & 1`, []string{`1:1: invalid operation: 1.5 & 1 (mismatched types float and int)`}},
+		{`true + true`, []string{`1:1: invalid operation: operator + not defined on bool`}},
+		{`var x = 1; x(2)`, []string{`1:12: invalid operation: cannot call non-function x (type int)`}},
+		{`1[0]`, []string{`1:1: invalid operation: cannot index 1 (type int)`}},
+		{`[1, 2]["a"]`, []string{`1:8: invalid array index "a" (type string), must be int`}},
+		{`"ab"[0:1]`, []string{`1:1: invalid operation: cannot slice "ab" (type string)`}},
+		{`{[1]: 2}`, []string{`1:2: invalid hash key [1] (type []int)`}},
+		{`len(1, 2)`, []string{`1:1: too many arguments in call to len`}},
+		{`keys([1])`, []string{`1:6: cannot use [1] (type []int) as hash in argument to keys`}},
+		{`var a int = 1; a += 1.5`, []string{`1:16: cannot use a += 1.5 (type float) as int in assignment to a`}},
+		{`var hi = "a" + "b"; hi - 1`, []string{`1:21: invalid operation: hi - 1 (mismatched types string and int)`}},
+		{`var f = func(x int) { x * 2 }; var s string = f(1)`, []string{`1:47: cannot use f(1) (type int) as string in variable declaration`}},
+		{`func f(b bool) { if b { return "y" }; "n" }; f(true) + 1`, []string{`1:46: invalid operation: f(true) + 1 (mismatched types string and int)`}},
+		{`var n = if true { 1 } else { 2 }; n + "s"`, []string{`1:35: invalid operation: n + "s" (mismatched types int and string)`}},
+		{`var a = ["x"]; a[0] - 1`, []string{`1:16: invalid operation: (a[0]) - 1 (mismatched types string and int)`}},
+		{`var h = {"a": true}; h["a"] * 2`, []string{`1:22: invalid operation: (h["a"]) * 2 (mismatched types bool and int)`}},
+		{`type P struct { x int }; P{x: "a"}`, []string{`1:31: cannot use "a" (type string) as int in struct literal`}},
+		{`type P struct { x int }; P{y: 1}`, []string{`1:28: unknown field y in struct literal of type P`}},
+		{`type P struct { x int }; var p = P{}; p.y`, []string{`1:39: p.y undefined (type P has no field or method y)`}},
+		{`var a = 1; a.x`, []string{`1:12: a.x undefined (type int has no field or method x)`}},
+		{`type P struct { x int }; var p = P{}; p.x = "s"`, []string{`1:45: cannot use "s" (type string) as int in assignment to p.x`}},
+		{`type P struct { s string }; var p = P{}; p.s++`, []string{`1:42: invalid operation: p.s++ (mismatched types string and int)`}},
+		{`type P struct { x int }; func (p P) f() {}; var p = P{}; p.f = 1`, []string{`1:58: cannot assign to method p.f`}},
+		{`type P struct { x int }; P{x: 1}.x + "s"`, []string{`1:26: invalid operation: P{x: 1}.x + "s" (mismatched types int and string)`}},
+		{`type P struct { x int }; func (p P) f(n int) int { n }; P{}.f("a")`, []string{`1:63: cannot use "a" (type string) as int in argument n of P{}.f`}},
+		{`type P struct { q Q }`, []string{`1:19: undefined type: Q`}},
+		{`func (p Q) f() {}`, []string{`1:9: undefined type: Q`}},
+		{`func (p int) f() {}`, []string{`1:9: invalid receiver type int`}},
+		{`type P struct { x int }; func (p P) x() {}`, []string{`1:37: field and method with the same name x`}},
+		{`var Q = 1; Q{}`, []string{`1:12: undefined type: Q`}},
+		{`func f(p P) {}; f(1); type P struct {}`, []string{`1:19: cannot use 1 (type int) as P in argument p of f`}},
+		{`func f() (int, int) { return 1, 2 }; var a, b, c = f()`, []string{`1:52: assignment mismatch: 3 variables but f() returns 2 values`}},
+		{`func f() (int, int) { return 1, 2 }; var t = f()`, []string{`1:46: assignment mismatch: 1 variable but f() returns 2 values`}},
+		{`var a, b = 1, 2, 3`, []string{`1:12: assignment mismatch: 2 variables but 3 values`}},
+		{`var a = 1; var b = 2; a, b = 1`, []string{`1:30: assignment mismatch: 2 variables but 1 value`}},
+		{`func f() (int, string) { return 1 }`, []string{`1:33: not enough return values: have (int), want (int, string)`}},
+		{`func f() int { return 1, 2 }`, []string{`1:23: too many return values: have (int, int), want (int)`}},
+		{`func f() (int, int) { return 1, 2 }; puts(f())`, []string{`1:43: multiple-value f() in single-value context`}},
+		{`func f() (int, int) { return 1, 2 }; var a = [f()]; var h = {"k": f()}`, []string{`1:47: multiple-value f() in single-value context`, `1:67: multiple-value f() in single-value context`}},
+		{`func f() (int, int) { return 1, 2 }; if f() { 1 } else if f() { 2 }`, []string{`1:41: multiple-value f() in single-value context`, `1:59: multiple-value f() in single-value context`}},
+		{`func f() (int, string) { return 1, 2 }`, []string{`1:33: cannot use 1, 2 (type (int, int)) as (int, string) in return statement`}},
+		{`func f() (int, int) { return 1, 2 }; var q, r string = f()`, []string{
+			`1:56: cannot use f() (type int) as string in variable declaration`,
+			`1:56: cannot use f() (type int) as string in variable declaration`,
+		}},
+		{`func f() (int, string) { return 1, "a" }; var q, r = f(); r - q`, []string{`1:59: invalid operation: r - q (mismatched types string and int)`}},
+		{`var a int = 1; var s = "s"; a, s = s, a`, []string{`1:36: cannot use s (type string) as int in assignment to a`}},
+		{`var a, b int = 1, "b"`, []string{`1:19: cannot use "b" (type string) as int in variable declaration`}},
+	}
+
+	for _, tt := range tests {
+		diags := checkInput(t, tt.input)
+		if len(diags) != len(tt.expected) {
+			t.Errorf("%q: expected %d errors, got %d: %q", tt.input, len(tt.expected), len(diags), errorsOf(diags))
+			continue
+		}
+		for i, d := range diags {
+			if d.Error() != tt.expected[i] {
+				t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected[i], d.Error())
+			}
+		}
+	}
+}
+
+func TestCheckValidPrograms(t *testing.T) {
+	tests := []string{
+		`var r float = 1; r = 2; r = 2.5`,
+		`var a = 1; a = "now a string"; a + "!"`,
+		`x = 5; x + 1`,
+		`func fib(n int) int { if n < 2 { return n }; return fib(n - 1) + fib(n - 2) }; fib(10)`,
+		`func add(x int, y int) int { x + y }; var z int = add(1, 2) * 3`,
+		`func a() { var b = 1; return func(x int) int { b = b + x; return b } }; var c = a(); c(1)`,
+		`var f = func(s string) string { s * 2 }; f("ab") + "c"`,
+		`var h = {"a": 1}; h["b"] = 2; h["a"] += 1; "a" in h; delete(h, "a"); keys(h)`,
+		`var a = [1, 2.5, "x"]; a[0] + 1; a[1:]; len(a); a + [3]`,
+		`var i = 0; for i < 3 { i++ }; for var j = 0; j++; j < 3 { echo(j) }`,
+		`var p float = 3 / 2.0; var q bool = 1 < 2 && "a" <= "b"; int(p) << 2`,
+		`func apply(g any, x int) int { g(x) }; apply(func(n int) int { n * 2 }, 3)`,
+		`func f() int { if true { return 1 } else { return 2 } }`,
+		`var u = unknown(1, "x"); u[0] + 1; u(2) * "s"`,
+		`func f(b bool) { if b { return 1 }; nil }; f(true) + 1`,
+		`func f(n int) { if n < 2 { return 1 }; n * f(n - 1) }; f(3) + 1.5`,
+		`var a = [1]; a[0] = "s"; a[0] + "t"; var h = {"n": 1}; h["n"] = true; !h["n"]`,
+		`var g = func() { var x = 1 }; g() + 1`,
+		`var n = if true { 1 }; n + "s"`,
+		`var best = nil; for _, v in [3, 1, 2] { if best == nil || v < best { best = v } }; best + 1`,
+		`var t = 0; for i, v in [1, 2] { t += i * v }; for k, v in ({"a": 1}) { k + "!"; t += v }; for i in 3 { t += i }; for i in range(2, t) {}`,
+		`var x = 3; switch x { case 1, 2: echo(x); fallthrough; default: x = 4 }; switch { case x > 1: x++ }`,
+		`type P struct { x int; next P }; var p = P{x: 1, next: P{}}; p.next.next.x + 1; p.next = nil`,
+		`func show(p P) string { p.str() }; func (p P) str() string { "P" }; type P struct {}`,
+		`type P struct { x float }; var p = P{x: 1}; p.x = 2; p.x += 0.5; p.x++`,
+		`type P struct {}; func (p P) me() { p }; var q P = P{}.me().me()`,
+		`func f() { type L struct { n int }; L{n: 1}.n + 1 }`,
+		`func divmod(a int, b int) (int, int) { return a / b, a % b }; var q, r = divmod(7, 2); q + r`,
+		`func f() { return 1, "a" }; var n, s = f(); n + 1; s + "b"`,
+		`var a, b float = 1, 2.5; a, b = b, a; var h = {"k": 1}; var l = [1]; h["k"], l[0] = 2, 3`,
+		`type P struct { x int; y int }; var p = P{}; p.x, p.y = 1, 2`,
+		`type S interface { two() (int, int) }; type T struct {}; func (t T) two() (int, int) { return 1, 2 }; var s S = T{}`,
+	}
+
+	for _, input := range tests {
+		diags := checkInput(t, input)
+		if len(diags) != 0 {
+			t.Errorf("%q: expected no errors, got %q", input, errorsOf(diags))
+		}
+	}
+}
+
+func TestCheckInterfaces(t *testing.T) {
+	shapes := "type Shape interface { area() int }; type Sq struct { s int }; func (q Sq) area() { q.s * q.s }; type T struct {}\n"
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`var s Shape = Sq{}; s.area() + 1; s.(Sq).s`, nil},
+		{`func f(s Shape) int { s.area() }; f(Sq{s: 1}); f(nil)`, nil},
+		{`var s Shape = Sq{}; s = T{}`, []string{`2:25: cannot use T{} (type T) as Shape in assignment to s`}},
+		{`var t Shape = T{}`, []string{`2:15: cannot use T{} (type T) as Shape in variable declaration`}},
+		{`func f(s Shape) {}; f(1)`, []string{`2:23: cannot use 1 (type int) as Shape in argument s of f`}},
+		{`type B interface { area() string }; var b B = Sq{}`, []string{`2:47: cannot use Sq{} (type Sq) as B in variable declaration`}},
+		{`var s Shape = Sq{}; s.x`, []string{`2:21: s.x undefined (type Shape has no field or method x)`}},
+		{`var s Shape = Sq{}; s.(T)`, []string{`2:21: impossible type assertion: T does not implement Shape (missing method area)`}},
+		{`var q = Sq{}; q.(Sq)`, []string{`2:15: invalid operation: q (type Sq) is not an interface`}},
+		{`var s Shape = Sq{}; s.(Foo)`, []string{`2:24: undefined type: Foo`}},
+		{`type I interface { f(x Foo) }`, []string{`2:24: undefined type: Foo`}},
+	}
+
+	for _, tt := range tests {
+		diags := checkInput(t, shapes+tt.input)
+		if len(diags) != len(tt.expected) {
+			t.Errorf("%q: expected %d errors, got %d: %q", tt.input, len(tt.expected), len(diags), errorsOf(diags))
+			continue
+		}
+		for i, d := range diags {
+			if d.Error() != tt.expected[i] {
+				t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected[i], d.Error())
+			}
+		}
+	}
+
+	diags := checkInput(t, shapes+"var t Shape = T{}")
+	if len(diags) != 1 || diags[0].Hint != "T does not implement Shape (missing method area)" {
+		t.Errorf("wrong hint, got %+v", diags)
+	}
+}
+
+func TestCheckEnumsAndMatch(t *testing.T) {
+	enums := "enum Result { Ok(v), Err(msg) }; enum Color { Red, Green, Blue }\n"
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`func f(r Result) { match r { Ok(v) => v, Err(e) => e } }; f(Ok(1)); f(Red)`, []string{`2:71: cannot use Red (type Color) as Result in argument r of f`}},
+		{`var c Color = Red; var n int = match c { Red => 1, Green => 2, Blue => 3 }`, nil},
+		{`var c = Green; var s string = match c { Red => "r", _ => "?" }`, nil},
+		{`match [1, 2] { [x, ..rest] => rest[0] + x, _ => 0 }`, nil},
+		{`var c = Red; match c { Red => 1 }`, []string{`2:20: non-exhaustive match: Green, Blue not covered`}},
+		{`var r = Ok(1); match r { Ok(1) => 1, Err(_) => 2 }`, []string{`2:22: non-exhaustive match: Ok not covered`}},
+		{`var c = Red; match c { Ok(v) => 1, _ => 2 }`, []string{`2:24: pattern Ok(v) (type Result) cannot match type Color`}},
+		{`var r = Ok(1); match r { Ok => 1, _ => 2 }`, []string{`2:26: wrong number of values in pattern Ok: got 0, want 1`}},
+		{`var r = Ok(1); match r { Ok(a, b) => 1, _ => 2 }`, []string{`2:26: wrong number of values in pattern Ok: got 2, want 1`}},
+		{`match 1 { Red(x) => 1 }`, []string{`2:11: Red is not a variant with values`}},
+		{`match 1 { "a" => 1, [x] => 2 }`, []string{`2:11: pattern "a" (type string) cannot match type int`, `2:21: pattern [x] cannot match type int`}},
+		{`var n int = match Red { Red => 1, Green => "g", Blue => 3 }`, nil},
+		{`var s string = match Ok(1) { Ok(v) => 1, Err(e) => 2 }`, []string{`2:16: cannot use match Ok(1) { Ok(v) => 1, Err(e) => 2 } (type int) as string in variable declaration`}},
+	}
+
+	for _, tt := range tests {
+		diags := checkInput(t, enums+tt.input)
+		if len(diags) != len(tt.expected) {
+			t.Errorf("%q: expected %d errors, got %d: %q", tt.input, len(tt.expected), len(diags), errorsOf(diags))
+			continue
+		}
+		for i, d := range diags {
+			if d.Error() != tt.expected[i] {
+				t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected[i], d.Error())
+			}
+		}
+	}
+
+	diags := checkInput(t, enums+"match Red { Red => 1 }")
+	if len(diags) != 1 || diags[0].Severity != diag.Warning || diags[0].Code != diag.NonExhaustive {
+		t.Errorf("expected a non-exhaustive warning, got %+v", diags)
+	}
+}
+
+func TestCheckerKeepsScope(t *testing.T) {
+	c := NewChecker()
+	c.Check(parse(t, `var n int = 1`))
+
+	diags := c.Check(parse(t, `n = "x"`))
+	if len(diags) != 1 || diags[0].Code != diag.MismatchedType {
+		t.Fatalf("expected a mismatched type error, got %q", errorsOf(diags))
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	program := parse(t, `func f(x int) float { x * 1.5 }; f(2)`)
+	c := NewChecker()
+	c.Check(program)
+
+	stmt := program.Statements[1].(*ast.ExpressionStatement)
+	if got := c.TypeOf(stmt.Expression); got != Float {
+		t.Errorf("wrong type for f(2), got %s", got)
+	}
+}
+
+func TestInferredTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a" + "b"`, "string"},
+		{`[1, 2]`, "[]int"},
+		{`[1, "a"]`, "array"},
+		{`[]`, "array"},
+		{`{"a": 1.5}`, "hash[string]float"},
+		{`func(x int) { x * 2 }`, "func(int) int"},
+		{`func(x int) { if x > 0 { return "+" }; return "-" }`, "func(int) string"},
+		{`func(x int) { if x > 0 { return "+" }; x }`, "func(int)"},
+		{`func() { func(s string) { s } }`, "func() func(string) string"},
+		{`func(a int, b int) (int, int) { return a / b, a % b }`, "func(int, int) (int, int)"},
+		{`func() { return 1, "a" }`, "func() (int, string)"},
+		{`if true { 1.5 } else if false { 2.5 } else { 0.0 }`, "float"},
+		{`[1] + [2]`, "[]int"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		c := NewChecker()
+		if diags := c.Check(program); len(diags) != 0 {
+			t.Errorf("%q: expected no errors, got %q", tt.input, errorsOf(diags))
+			continue
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if got := c.TypeOf(stmt.Expression).String(); got != tt.expected {
+			t.Errorf("%q: wrong type. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBuiltinSignatures(t *testing.T) {
+	for name := range token.Builtins {
+		if _, ok := builtins[name]; !ok {
+			t.Errorf("builtin %s has no signature", name)
+		}
+	}
+	for name := range builtins {
+		if !token.Builtins[name] {
+			t.Errorf("signature %s is not a builtin name", name)
+		}
+	}
+}
+
+func TestAssignableTo(t *testing.T) {
+	tests := []struct {
+		v, t     Type
+		expected bool
+	}{
+		{Int, Int, true},
+		{Int, Float, true},
+		{Float, Int, false},
+		{Nil, Int, false},
+		{Nil, &Array{Elem: Any}, true},
+		{&Array{Elem: Int}, &Array{Elem: Any}, true},
+		{&Array{Elem: Int}, &Array{Elem: String}, false},
+		{&Func{Params: []Type{Int}, Result: Int}, &Func{Params: []Type{Int}, Result: Any}, true},
+		{Nil, &Func{Result: Any}, true},
+		{&Func{Params: []Type{Int}, Result: Int}, &Func{Params: []Type{String}, Result: Int}, false},
+		{&Struct{Name: "S", Methods: map[string]*Func{"f": {Result: Int}}}, &Interface{Name: "I", Methods: map[string]*Func{"f": {Result: Int}}}, true},
+		{&Struct{Name: "S"}, &Interface{Name: "I", Methods: map[string]*Func{"f": {Result: Int}}}, false},
+		{&Interface{Name: "J"}, &Interface{Name: "I"}, true},
+		{Int, &Interface{Name: "I"}, false},
+		{Nil, &Interface{Name: "I"}, true},
+		{Any, String, true},
+		{String, Any, true},
+	}
+
+	for _, tt := range tests {
+		if got := AssignableTo(tt.v, tt.t); got != tt.expected {
+			t.Errorf("AssignableTo(%s, %s) = %t, want %t", tt.v, tt.t, got, tt.expected)
+		}
+	}
+}
+
+func checkInput(t *testing.T, input string) []*diag.Diagnostic {
+	return Check(parse(t, input))
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.Parse()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("%q: parser errors %q", input, errors)
+	}
+	return program
+}
+
+func errorsOf(diags []*diag.Diagnostic) []string {
+	errors := []string{}
+	for _, d := range diags {
+		errors = append(errors, d.Error())
+	}
+	return errors
+}
@@ -0,0 +1,302 @@
+// Package types checks the type annotations of a program before it runs:
+// `var x int = ...`, function parameters and return types.
+package types
+
+import (
+	"sort"
+	"strings"
+)
+
+// Type is the static type of an expression.
+type Type interface {
+	String() string
+}
+
+// Basic is a type known by its name only: int, float, string, bool, nil.
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Int    = &Basic{Name: "int"}
+	Float  = &Basic{Name: "float"}
+	String = &Basic{Name: "string"}
+	Bool   = &Basic{Name: "bool"}
+	Nil    = &Basic{Name: "nil"}
+
+	// Any is the type of what the checker knows nothing about, an Any
+	// never causes an error.
+	Any = &Basic{Name: "any"}
+)
+
+type Array struct {
+	Elem Type
+}
+
+func (a *Array) String() string {
+	if a.Elem == Any {
+		return "array"
+	}
+	return "[]" + a.Elem.String()
+}
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string {
+	if h.Key == Any && h.Value == Any {
+		return "hash"
+	}
+	return "hash[" + h.Key.String() + "]" + h.Value.String()
+}
+
+// Struct is a struct type declared by a type statement, Fields are in
+// declaration order.
+type Struct struct {
+	Name    string
+	Fields  []*Var
+	Methods map[string]*Func
+}
+
+func (s *Struct) String() string { return s.Name }
+
+// Field returns the field name of s, nil if there is none.
+func (s *Struct) Field(name string) *Var {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Interface is an interface type, implemented by the structs that have
+// all its methods.
+type Interface struct {
+	Name    string
+	Methods map[string]*Func
+}
+
+func (i *Interface) String() string { return i.Name }
+
+// Enum is an enum type. The type of a variant without values is the enum,
+// the others are constructors: functions that return the enum.
+type Enum struct {
+	Name     string
+	Variants []*Var
+}
+
+func (e *Enum) String() string { return e.Name }
+
+// Variant returns the variant name of e, nil if there is none.
+func (e *Enum) Variant(name string) *Var {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// Tuple is the type of the values of a function returning several of them.
+type Tuple struct {
+	Elems []Type
+}
+
+func (t *Tuple) String() string {
+	elems := []string{}
+	for _, el := range t.Elems {
+		elems = append(elems, el.String())
+	}
+	return "(" + strings.Join(elems, ", ") + ")"
+}
+
+// Missing returns the first method of iface, by name, that t doesn't have
+// with the same signature. It returns "" when t implements iface.
+func Missing(t Type, iface *Interface) string {
+	var methods map[string]*Func
+	switch t := t.(type) {
+	case *Struct:
+		methods = t.Methods
+	case *Interface:
+		methods = t.Methods
+	}
+
+	names := []string{}
+	for name := range iface.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m, ok := methods[name]
+		if !ok || !Identical(m, iface.Methods[name]) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Func is the signature of a function. With Variadic, the last parameter
+// takes any number of arguments. Names are the parameter names, when known.
+type Func struct {
+	Params   []Type
+	Names    []string
+	Result   Type
+	Variadic bool
+}
+
+func (f *Func) String() string {
+	params := []string{}
+	for i, p := range f.Params {
+		s := p.String()
+		if f.Variadic && i == len(f.Params)-1 {
+			s = "..." + s
+		}
+		params = append(params, s)
+	}
+
+	s := "func(" + strings.Join(params, ", ") + ")"
+	if f.Result != Any {
+		s += " " + f.Result.String()
+	}
+	return s
+}
+
+// universe holds the type names usable in annotations.
+var universe = map[string]Type{
+	"int":    Int,
+	"float":  Float,
+	"string": String,
+	"bool":   Bool,
+	"any":    Any,
+	"array":  &Array{Elem: Any},
+	"hash":   &Hash{Key: Any, Value: Any},
+}
+
+// builtins are the signatures of eval's builtin functions.
+var builtins = map[string]*Func{
+	"len":    {Params: []Type{Any}, Result: Int},
+	"echo":   {Params: []Type{Any}, Result: Nil, Variadic: true},
+	"puts":   {Params: []Type{Any}, Result: Nil, Variadic: true},
+	"delete": {Params: []Type{universe["hash"], Any}, Result: Nil},
+	"keys":   {Params: []Type{universe["hash"]}, Result: universe["array"]},
+	"values": {Params: []Type{universe["hash"]}, Result: universe["array"]},
+	"int":    {Params: []Type{Any}, Result: Int},
+	"float":  {Params: []Type{Any}, Result: Float},
+	"range":  {Params: []Type{Int}, Result: &Array{Elem: Int}, Variadic: true},
+}
+
+// Lookup returns the type named by an annotation.
+func Lookup(name string) (Type, bool) {
+	t, ok := universe[name]
+	return t, ok
+}
+
+// AssignableTo reports whether a value of type v can be stored where a t
+// is expected. Ints are promoted to floats, nil is only a value of the
+// container, struct, interface and function types.
+func AssignableTo(v, t Type) bool {
+	if v == Any || t == Any || Identical(v, t) {
+		return true
+	}
+
+	switch t := t.(type) {
+	case *Basic:
+		return t == Float && v == Int
+	case *Array:
+		if v == Nil {
+			return true
+		}
+		if v, ok := v.(*Array); ok {
+			return AssignableTo(v.Elem, t.Elem)
+		}
+	case *Hash:
+		if v == Nil {
+			return true
+		}
+		if v, ok := v.(*Hash); ok {
+			return AssignableTo(v.Key, t.Key) && AssignableTo(v.Value, t.Value)
+		}
+	case *Interface:
+		switch v.(type) {
+		case *Struct, *Interface:
+			return Missing(v, t) == ""
+		}
+		return v == Nil
+	case *Struct, *Func:
+		return v == Nil
+	case *Tuple:
+		v, ok := v.(*Tuple)
+		if !ok || len(v.Elems) != len(t.Elems) {
+			return false
+		}
+		for i := range t.Elems {
+			if !AssignableTo(v.Elems[i], t.Elems[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Identical reports whether x and y are the same type, Any is identical to
+// every type.
+func Identical(x, y Type) bool {
+	if x == y || x == Any || y == Any {
+		return true
+	}
+
+	switch x := x.(type) {
+	case *Array:
+		y, ok := y.(*Array)
+		return ok && Identical(x.Elem, y.Elem)
+	case *Hash:
+		y, ok := y.(*Hash)
+		return ok && Identical(x.Key, y.Key) && Identical(x.Value, y.Value)
+	case *Func:
+		y, ok := y.(*Func)
+		if !ok || x.Variadic != y.Variadic || len(x.Params) != len(y.Params) {
+			return false
+		}
+		for i := range x.Params {
+			if !Identical(x.Params[i], y.Params[i]) {
+				return false
+			}
+		}
+		return Identical(x.Result, y.Result)
+	case *Tuple:
+		y, ok := y.(*Tuple)
+		if !ok || len(x.Elems) != len(y.Elems) {
+			return false
+		}
+		for i := range x.Elems {
+			if !Identical(x.Elems[i], y.Elems[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isNumeric(t Type) bool { return t == Int || t == Float }
+
+// unify returns the type shared by all of ts, or Any when they differ or
+// when there are none.
+func unify(ts []Type) Type {
+	if len(ts) == 0 {
+		return Any
+	}
+	for _, t := range ts {
+		if t == Any || !Identical(t, ts[0]) {
+			return Any
+		}
+	}
+	return ts[0]
+}